@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/common"
+	"dumpbeat/pkg/log"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// archiveFilter selects dumps in archives by flags of search, extract and replay commands
+type archiveFilter struct {
+	app     string
+	hash    string
+	archive string
+	since   string
+	until   string
+}
+
+var (
+	filter  archiveFilter
+	destDir string
+)
+
+func init() {
+	addFilterFlags(archiveSearchCmd.Flags(), &filter)
+	addFilterFlags(archiveExtractCmd.Flags(), &filter)
+	archiveExtractCmd.Flags().StringVar(&destDir, "dest", ".", "Directory for extracted dumps")
+	archiveCmd.AddCommand(archiveListCmd, archiveSearchCmd, archiveExtractCmd)
+	rootCmd.AddCommand(archiveCmd)
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Browse archives of backup directory",
+}
+
+var archiveListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List archives with count and size of dumps",
+	Args:  cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		config := root.GetConfig()
+		archives, err := common.ListArchives(config.BackupDir)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "ARCHIVE\tDUMPS\tDUMPS SIZE\tARCHIVE SIZE")
+		for _, archive := range archives {
+			index, err := common.ReadArchiveIndex(config.BackupDir, archive)
+			if err != nil {
+				log.Error(err.Error())
+				continue
+			}
+			var size int64
+			for _, member := range index.Members {
+				size += member.Size
+			}
+			var archiveSize int64
+			if fileInfo, err := os.Stat(archive); err == nil {
+				archiveSize = fileInfo.Size()
+			}
+			fmt.Fprintf(writer, "%s\t%d\t%d\t%d\n", index.Archive, len(index.Members), size, archiveSize)
+		}
+		_ = writer.Flush()
+	},
+}
+
+var archiveSearchCmd = &cobra.Command{
+	Use:   "search [pattern]",
+	Short: "Search dumps in archives by name pattern, application, date and content hash",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		matches := searchArchives(filter, args)
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "ARCHIVE\tDUMP\tAPP\tSIZE\tMODIFIED\tSHA256")
+		for _, archive := range matches.archives {
+			for _, member := range matches.members[archive] {
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\t%s\n", filepath.Base(archive), member.Name, member.App,
+					member.Size, member.ModTime.Format(time.RFC3339), member.SHA256)
+			}
+		}
+		_ = writer.Flush()
+	},
+}
+
+var archiveExtractCmd = &cobra.Command{
+	Use:   "extract [pattern]",
+	Short: "Extract dumps matching search from archives",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		matches := searchArchives(filter, args)
+		failed := false
+		for _, archive := range matches.archives {
+			names := make(map[string]bool)
+			for _, member := range matches.members[archive] {
+				names[member.Name] = true
+			}
+			extracted, err := common.ExtractMembers(archive, names, destDir)
+			for _, filePath := range extracted {
+				fmt.Println(filePath)
+			}
+			if err != nil {
+				log.Error(err.Error())
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+type archiveMatches struct {
+	archives []string
+	members  map[string][]common.IndexMember
+}
+
+func addFilterFlags(flags *pflag.FlagSet, filter *archiveFilter) {
+	flags.StringVar(&filter.app, "app", "", "Application of dumps")
+	flags.StringVar(&filter.hash, "hash", "", "Prefix of sha256 of dump content")
+	flags.StringVar(&filter.archive, "archive", "", "Pattern of archive names (e.g. 2020-01-*)")
+	flags.StringVar(&filter.since, "since", "", "Dumps modified since date (2006-01-02)")
+	flags.StringVar(&filter.until, "until", "", "Dumps modified before end of date (2006-01-02)")
+}
+
+// searchArchives return dumps from indexes of all archives matching pattern and filter
+func searchArchives(filter archiveFilter, args []string) archiveMatches {
+	config := root.GetConfig()
+	pattern := ""
+	if len(args) > 0 {
+		pattern = args[0]
+	}
+	since, until, err := filter.dates()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	archives, err := common.ListArchives(config.BackupDir)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	matches := archiveMatches{members: make(map[string][]common.IndexMember)}
+	for _, archive := range archives {
+		if !filter.archiveMatches(archive) {
+			continue
+		}
+		index, err := common.ReadArchiveIndex(config.BackupDir, archive)
+		if err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		for _, member := range index.Members {
+			if !filter.matches(member, pattern, since, until) {
+				continue
+			}
+			if len(matches.members[archive]) == 0 {
+				matches.archives = append(matches.archives, archive)
+			}
+			matches.members[archive] = append(matches.members[archive], member)
+		}
+	}
+	return matches
+}
+
+func (filter archiveFilter) archiveMatches(archive string) bool {
+	if filter.archive == "" {
+		return true
+	}
+	matched, _ := filepath.Match(filter.archive, filepath.Base(archive))
+	return matched
+}
+
+func (filter archiveFilter) matches(member common.IndexMember, pattern string, since, until time.Time) bool {
+	if pattern != "" {
+		nameMatched, _ := path.Match(pattern, member.Name)
+		baseMatched, _ := path.Match(pattern, path.Base(member.Name))
+		if !nameMatched && !baseMatched {
+			return false
+		}
+	}
+	if filter.app != "" && member.App != filter.app {
+		return false
+	}
+	if filter.hash != "" && !strings.HasPrefix(member.SHA256, strings.ToLower(filter.hash)) {
+		return false
+	}
+	if !since.IsZero() && member.ModTime.Before(since) {
+		return false
+	}
+	if !until.IsZero() && !member.ModTime.Before(until) {
+		return false
+	}
+	return true
+}
+
+// dates return bounds of modification time. Until is start of day after until date
+func (filter archiveFilter) dates() (time.Time, time.Time, error) {
+	since, err := parseFilterDate(filter.since)
+	if err != nil {
+		return since, since, err
+	}
+	until, err := parseFilterDate(filter.until)
+	if err != nil {
+		return since, until, err
+	}
+	if !until.IsZero() {
+		until = until.AddDate(0, 0, 1)
+	}
+	return since, until, nil
+}
+
+func parseFilterDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
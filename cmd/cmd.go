@@ -2,51 +2,132 @@ package cmd
 
 import (
 	root "dumpbeat/pkg"
+	"dumpbeat/pkg/checkpoint"
 	"dumpbeat/pkg/common"
-	"dumpbeat/pkg/consul"
+	"dumpbeat/pkg/discovery"
 	"dumpbeat/pkg/dump"
 	"dumpbeat/pkg/exporter"
+	"dumpbeat/pkg/health"
 	"dumpbeat/pkg/log"
+	"dumpbeat/pkg/scheduler"
 	"dumpbeat/pkg/version"
 	"dumpbeat/pkg/watcher"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
-var (
-	config *root.Config
-)
-
 const (
-	DumpDir             = "dump_dir"
-	BackupDir           = "backup_dir"
-	PatternFileFilter   = "pattern_file_filter"
-	FileWaitTime        = "file_wait_time"
-	APIUrl              = "api_url"
-	APIToken            = "api_token"
-	DaysToArchive       = "days_to_archive"
-	NodeName            = "node_name"
-	MaxFileSize         = "max_file_size"
-	Aliases             = "aliases"
-	LogLevel            = "log_level"
-	ConsulHost          = "consul_host"
-	ConsulServiceName   = "consul_service_name"
-	ExporterBindAddress = "exporter_bind_address"
-	ExporterBindPort    = "exporter_bind_port"
+	DumpDir                       = "dump_dir"
+	BackupDir                     = "backup_dir"
+	PatternFileFilter             = "pattern_file_filter"
+	FileWaitTime                  = "file_wait_time"
+	APIUrl                        = "api_url"
+	APIToken                      = "api_token"
+	DaysToArchive                 = "days_to_archive"
+	NodeName                      = "node_name"
+	MaxFileSize                   = "max_file_size"
+	Aliases                       = "aliases"
+	LogLevel                      = "log_level"
+	ConsulHost                    = "consul_host"
+	ConsulServiceName             = "consul_service_name"
+	ExporterBindAddress           = "exporter_bind_address"
+	ExporterBindPort              = "exporter_bind_port"
+	APIConnectTimeout             = "api_connect_timeout"
+	APIResponseTimeout            = "api_response_timeout"
+	APITimeout                    = "api_timeout"
+	APIKeepAlive                  = "api_keep_alive"
+	APIProxy                      = "api_proxy"
+	APINoProxy                    = "api_no_proxy"
+	APIMaxIdleConns               = "api_max_idle_conns"
+	APIMaxIdleConnsPerHost        = "api_max_idle_conns_per_host"
+	APIMaxConnsPerHost            = "api_max_conns_per_host"
+	APIIdleConnTimeout            = "api_idle_conn_timeout"
+	APISuccessCodes               = "api_success_codes"
+	APIMaxRetries                 = "api_max_retries"
+	APIRetryBackoff               = "api_retry_backoff"
+	APIMaxRetryAfter              = "api_max_retry_after"
+	APIRateLimit                  = "api_rate_limit"
+	APIRateBurst                  = "api_rate_burst"
+	APIBytesRateLimit             = "api_bytes_rate_limit"
+	CircuitBreakerFailures        = "circuit_breaker_failures"
+	CircuitBreakerOpenTime        = "circuit_breaker_open_time"
+	CircuitBreakerProbes          = "circuit_breaker_probes"
+	BatchEnabled                  = "batch_enabled"
+	BatchMaxCount                 = "batch_max_count"
+	BatchMaxBytes                 = "batch_max_bytes"
+	BatchMaxWait                  = "batch_max_wait"
+	BatchFormat                   = "batch_format"
+	BatchEndpoint                 = "batch_endpoint"
+	DataDir                       = "data_dir"
+	AckRetention                  = "ack_retention"
+	ReadinessStrategy             = "readiness_strategy"
+	ReadinessOverrides            = "readiness_overrides"
+	ReadinessQuietPeriod          = "readiness_quiet_period"
+	ReadinessStablePolls          = "readiness_stable_polls"
+	ReadinessStableInterval       = "readiness_stable_interval"
+	ReadinessMarkerSuffix         = "readiness_marker_suffix"
+	WatcherBackend                = "watcher_backend"
+	WatcherPollInterval           = "watcher_poll_interval"
+	PendingFilesLimit             = "pending_files_limit"
+	RegistryFlushInterval         = "registry_flush_interval"
+	RegistryCompactInterval       = "registry_compact_interval"
+	TailPattern                   = "tail_pattern"
+	TailDelimiter                 = "tail_delimiter"
+	TailMultilineStart            = "tail_multiline_start"
+	TailRecordTimeout             = "tail_record_timeout"
+	Splitter                      = "splitter"
+	SplitterOverrides             = "splitter_overrides"
+	SplitterStart                 = "splitter_start"
+	SplitterEnd                   = "splitter_end"
+	WalkSchedule                  = "walk_schedule"
+	CleanupSchedule               = "cleanup_schedule"
+	ArchiveSchedule               = "archive_schedule"
+	JobJitter                     = "job_jitter"
+	AdminToken                    = "admin_token"
+	ArchiveMaxAge                 = "archive_max_age"
+	ArchiveMaxSize                = "archive_max_size"
+	ArchiveMaxCount               = "archive_max_count"
+	BackupMaxAge                  = "backup_max_age"
+	BackupMaxSize                 = "backup_max_size"
+	BackupMaxCount                = "backup_max_count"
+	DiskHighWatermark             = "disk_high_watermark"
+	DiskLowWatermark              = "disk_low_watermark"
+	DiskWatermarkMinArchives      = "disk_watermark_min_archives"
+	RetentionSchedule             = "retention_schedule"
+	ArchiveFormat                 = "archive_format"
+	ArchiveCompressionLevel       = "archive_compression_level"
+	ArchiveMemberNames            = "archive_member_names"
+	ArchiveGrouping               = "archive_grouping"
+	ServiceDiscovery              = "service_discovery"
+	FileSDPath                    = "file_sd_path"
+	EtcdEndpoints                 = "etcd_endpoints"
+	EtcdPrefix                    = "etcd_prefix"
+	EtcdTTL                       = "etcd_ttl"
+	HealthWalkTimeout             = "health_walk_timeout"
+	HealthUploadTimeout           = "health_upload_timeout"
+	HealthCheckInterval           = "health_check_interval"
+	ConsulServiceID               = "consul_service_id"
+	ConsulServiceTags             = "consul_service_tags"
+	ConsulServiceMeta             = "consul_service_meta"
+	ConsulDeregisterCriticalAfter = "consul_deregister_critical_after"
+	APIConsulService              = "api_consul_service"
+	APIConsulTag                  = "api_consul_tag"
+	ConfigConsulPrefix            = "config_consul_prefix"
 )
 
 func init() {
-	config = root.GetConfig()
 	viper.SetEnvPrefix("DUMPBEAT")
 	viper.AutomaticEnv()
-	flags := rootCmd.Flags()
+	flags := rootCmd.PersistentFlags()
 	flags.StringP(DumpDir, "", "/dumps", "Dumps directory")
 	flags.StringP(BackupDir, "", "/backup-dumps", "Directory for backup dumps")
 	flags.StringP(PatternFileFilter, "", "*.txt", "Pattern for dump search")
@@ -60,8 +141,89 @@ func init() {
 	flags.StringP(LogLevel, "", "info", "Log level (panic|fatal|error|warn|info|debug|trace)")
 	flags.StringP(ConsulHost, "", "127.0.0.1:8500", "Consul host")
 	flags.StringP(ConsulServiceName, "", "dumpbeat", "Consul service name")
-	flags.StringP(ExporterBindAddress, "", config.ExporterBindAddress, "Exporter bind address")
-	flags.IntP(ExporterBindPort, "", config.ExporterBindPort, "Exporter bind port")
+	flags.StringP(ExporterBindAddress, "", root.GetConfig().ExporterBindAddress, "Exporter bind address")
+	flags.IntP(ExporterBindPort, "", root.GetConfig().ExporterBindPort, "Exporter bind port")
+	flags.IntP(APIConnectTimeout, "", 10, "Dump viewer API connect timeout (seconds)")
+	flags.IntP(APIResponseTimeout, "", 30, "Dump viewer API response headers timeout (seconds)")
+	flags.IntP(APITimeout, "", 60, "Dump viewer API total request timeout (seconds)")
+	flags.IntP(APIKeepAlive, "", 30, "Dump viewer API keep-alive period (seconds)")
+	flags.StringP(APIProxy, "", "", "Dump viewer API HTTP proxy url (default from HTTP_PROXY/HTTPS_PROXY)")
+	flags.StringP(APINoProxy, "", "", "Hosts excluded from proxy (default from NO_PROXY)")
+	flags.IntP(APIMaxIdleConns, "", 10, "Dump viewer API max idle connections")
+	flags.IntP(APIMaxIdleConnsPerHost, "", 4, "Dump viewer API max idle connections per host")
+	flags.IntP(APIMaxConnsPerHost, "", 8, "Dump viewer API max connections per host (0 - unlimited)")
+	flags.IntP(APIIdleConnTimeout, "", 90, "Dump viewer API idle connection timeout (seconds)")
+	flags.StringP(APISuccessCodes, "", "200,201,202", "Comma separated HTTP status codes treated as successful dump upload")
+	flags.IntP(APIMaxRetries, "", 3, "Max retries of dump upload on retryable errors (network, 408, 429, 5xx)")
+	flags.IntP(APIRetryBackoff, "", 5, "Initial backoff between upload retries (seconds), doubled on each retry")
+	flags.IntP(APIMaxRetryAfter, "", 300, "Max delay before upload retry including Retry-After (seconds)")
+	flags.Float64P(APIRateLimit, "", 0, "Max upload requests per second to each API endpoint (0 - unlimited)")
+	flags.IntP(APIRateBurst, "", 1, "Burst of upload requests to each API endpoint")
+	flags.IntP(APIBytesRateLimit, "", 0, "Max uploaded bytes per second to each API endpoint (0 - unlimited)")
+	flags.IntP(CircuitBreakerFailures, "", 5, "Consecutive upload failures to open circuit breaker (0 - disabled)")
+	flags.IntP(CircuitBreakerOpenTime, "", 60, "Time to pause uploads before probe API endpoint (seconds)")
+	flags.IntP(CircuitBreakerProbes, "", 1, "Probe requests allowed in half-open circuit breaker state")
+	flags.BoolP(BatchEnabled, "", false, "Send dumps of the same app in batches")
+	flags.IntP(BatchMaxCount, "", 50, "Max dumps in one batch (0 - unlimited)")
+	flags.IntP(BatchMaxBytes, "", 5242880, "Max dumps content size in one batch (bytes, 0 - unlimited)")
+	flags.IntP(BatchMaxWait, "", 10, "Max time to collect batch before send (seconds)")
+	flags.StringP(BatchFormat, "", "json", "Batch payload format (json|ndjson)")
+	flags.StringP(BatchEndpoint, "", "add_batch", "Dump viewer API batch endpoint relative to app url")
+	flags.StringP(DataDir, "", "/var/lib/dumpbeat", "Directory for dumpbeat state files")
+	flags.IntP(AckRetention, "", 168, "Time to keep acknowledged dump idempotency keys (hours)")
+	flags.StringP(ReadinessStrategy, "", "quiet", "Strategy to detect completely written dump (quiet|close_write|stable|marker|rename)")
+	flags.StringP(ReadinessOverrides, "", "", "Readiness strategies for dumps app (app:strategy,...)")
+	flags.IntP(ReadinessQuietPeriod, "", 10, "Time without writes before watched dump is ready for quiet strategy (seconds)")
+	flags.IntP(ReadinessStablePolls, "", 3, "Polls with unchanged size and modification time for stable strategy")
+	flags.IntP(ReadinessStableInterval, "", 5, "Min interval between polls for stable strategy (seconds)")
+	flags.StringP(ReadinessMarkerSuffix, "", ".done", "Suffix of marker file for marker strategy")
+	flags.StringP(WatcherBackend, "", "auto", "Filesystem watcher backend (auto|fsnotify|poll)")
+	flags.IntP(WatcherPollInterval, "", 10, "Directory polling interval for poll watcher backend (seconds)")
+	flags.IntP(PendingFilesLimit, "", 10000, "Max files waiting for readiness in watcher (0 - unlimited)")
+	flags.IntP(RegistryFlushInterval, "", 1, "Interval of writing registry of dump files state and acknowledged keys to data dir (seconds)")
+	flags.IntP(RegistryCompactInterval, "", 3600, "Interval of dropping registry entries of disappeared files (seconds)")
+	flags.StringP(TailPattern, "", "", "Pattern of append-only dump logs sent record by record (tail mode)")
+	flags.StringP(TailDelimiter, "", "", "Records delimiter in tailed files, escape sequences allowed (e.g. \\n\\n)")
+	flags.StringP(TailMultilineStart, "", "", "Regexp of first line of record in tailed files")
+	flags.IntP(TailRecordTimeout, "", 30, "Time without writes to consider last record of tailed file complete (seconds)")
+	flags.StringP(Splitter, "", "", "Split files with several dumps into records: java, go, python or custom")
+	flags.StringP(SplitterOverrides, "", "", "Splitter per application (e.g. app1:java,app2:none)")
+	flags.StringP(SplitterStart, "", "", "Regexp of first line of record for custom splitter")
+	flags.StringP(SplitterEnd, "", "", "Regexp of last line of record for custom splitter")
+	flags.StringP(WalkSchedule, "", "120", "Schedule of dump directory walk: seconds, duration (5m) or cron expression")
+	flags.StringP(CleanupSchedule, "", "120", "Schedule of empty folders cleanup: seconds, duration or cron expression")
+	flags.StringP(ArchiveSchedule, "", "120", "Schedule of backup archiving: seconds, duration or cron expression")
+	flags.IntP(JobJitter, "", 0, "Maximum random delay added to scheduled jobs (seconds)")
+	flags.StringP(AdminToken, "", "", "Bearer token required by admin endpoints on exporter port (empty - admin endpoints disabled)")
+	flags.IntP(ArchiveMaxAge, "", 0, "Delete archives older than days (0 - keep forever)")
+	flags.IntP(ArchiveMaxSize, "", 0, "Maximum total size of archives in MB, oldest are deleted (0 - unlimited)")
+	flags.IntP(ArchiveMaxCount, "", 0, "Maximum count of archives, oldest are deleted (0 - unlimited)")
+	flags.IntP(BackupMaxAge, "", 0, "Delete not archived backups older than days (0 - keep forever)")
+	flags.IntP(BackupMaxSize, "", 0, "Maximum total size of not archived backups in MB (0 - unlimited)")
+	flags.IntP(BackupMaxCount, "", 0, "Maximum count of not archived backups (0 - unlimited)")
+	flags.Float64P(DiskHighWatermark, "", 0, "Backup filesystem usage in percents to start deleting oldest archives and backups (0 - disabled)")
+	flags.Float64P(DiskLowWatermark, "", 80, "Backup filesystem usage in percents to stop deleting after high watermark was reached")
+	flags.IntP(DiskWatermarkMinArchives, "", 3, "Count of newest archives which are never deleted when high watermark is reached")
+	flags.StringP(RetentionSchedule, "", "300", "Schedule of retention policy: seconds, duration or cron expression")
+	flags.StringP(ArchiveFormat, "", "tar.gz", "Format of backup archives: tar.gz, tar.zst, tar.xz or zip")
+	flags.IntP(ArchiveCompressionLevel, "", 0, "Compression level of backup archives (0 - default of format)")
+	flags.StringP(ArchiveMemberNames, "", "relative", "Names of dumps in archives: relative (to backup_dir) or absolute")
+	flags.StringP(ArchiveGrouping, "", "day", "Group dumps to archives: day, app_day or week")
+	flags.StringP(ServiceDiscovery, "", "consul", "Service discovery backend: none, consul, file_sd or etcd")
+	flags.StringP(FileSDPath, "", "/etc/prometheus/file_sd/dumpbeat.json", "Prometheus file_sd target file for file_sd discovery")
+	flags.StringP(EtcdEndpoints, "", "http://127.0.0.1:2379", "Comma separated etcd endpoints for etcd discovery")
+	flags.StringP(EtcdPrefix, "", "/services", "Prefix of service keys in etcd")
+	flags.IntP(EtcdTTL, "", 90, "TTL of etcd lease of service key (seconds)")
+	flags.IntP(HealthWalkTimeout, "", 900, "Time without completed walk of dump directory to report service critical (seconds, 0 - disabled)")
+	flags.IntP(HealthUploadTimeout, "", 900, "Time of failing uploads to report service critical (seconds, 0 - disabled)")
+	flags.StringP(HealthCheckInterval, "", "30s", "Interval of consul HTTP check of health endpoint")
+	flags.StringP(ConsulServiceID, "", "", "Consul service instance ID (default <service name>-<node name>-<exporter port>)")
+	flags.StringP(ConsulServiceTags, "", "", "Consul service tags, comma separated")
+	flags.StringP(ConsulServiceMeta, "", "", "Additional consul service meta (key1:value1,key2:value2)")
+	flags.StringP(ConsulDeregisterCriticalAfter, "", "", "Time after which consul removes service with critical checks (e.g. 30m, empty - never)")
+	flags.StringP(APIConsulService, "", "", "Consul service of dump viewer API. Healthy instances are used instead of host of api_url")
+	flags.StringP(APIConsulTag, "", "", "Tag of consul service of dump viewer API")
+	flags.StringP(ConfigConsulPrefix, "", "", "Consul KV prefix of central configuration (<prefix>/common/<flag>, <prefix>/nodes/<node name>/<flag>)")
 	err := viper.BindPFlag(DumpDir, flags.Lookup(DumpDir))
 	if err != nil {
 		log.Fatal(err.Error())
@@ -122,6 +284,330 @@ func init() {
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	err = viper.BindPFlag(APIConnectTimeout, flags.Lookup(APIConnectTimeout))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIResponseTimeout, flags.Lookup(APIResponseTimeout))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APITimeout, flags.Lookup(APITimeout))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIKeepAlive, flags.Lookup(APIKeepAlive))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIProxy, flags.Lookup(APIProxy))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APINoProxy, flags.Lookup(APINoProxy))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIMaxIdleConns, flags.Lookup(APIMaxIdleConns))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIMaxIdleConnsPerHost, flags.Lookup(APIMaxIdleConnsPerHost))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIMaxConnsPerHost, flags.Lookup(APIMaxConnsPerHost))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIIdleConnTimeout, flags.Lookup(APIIdleConnTimeout))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APISuccessCodes, flags.Lookup(APISuccessCodes))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIMaxRetries, flags.Lookup(APIMaxRetries))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIRetryBackoff, flags.Lookup(APIRetryBackoff))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIMaxRetryAfter, flags.Lookup(APIMaxRetryAfter))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIRateLimit, flags.Lookup(APIRateLimit))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIRateBurst, flags.Lookup(APIRateBurst))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIBytesRateLimit, flags.Lookup(APIBytesRateLimit))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(CircuitBreakerFailures, flags.Lookup(CircuitBreakerFailures))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(CircuitBreakerOpenTime, flags.Lookup(CircuitBreakerOpenTime))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(CircuitBreakerProbes, flags.Lookup(CircuitBreakerProbes))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(BatchEnabled, flags.Lookup(BatchEnabled))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(BatchMaxCount, flags.Lookup(BatchMaxCount))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(BatchMaxBytes, flags.Lookup(BatchMaxBytes))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(BatchMaxWait, flags.Lookup(BatchMaxWait))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(BatchFormat, flags.Lookup(BatchFormat))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(BatchEndpoint, flags.Lookup(BatchEndpoint))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(DataDir, flags.Lookup(DataDir))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(AckRetention, flags.Lookup(AckRetention))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ReadinessStrategy, flags.Lookup(ReadinessStrategy))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ReadinessOverrides, flags.Lookup(ReadinessOverrides))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ReadinessQuietPeriod, flags.Lookup(ReadinessQuietPeriod))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ReadinessStablePolls, flags.Lookup(ReadinessStablePolls))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ReadinessStableInterval, flags.Lookup(ReadinessStableInterval))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ReadinessMarkerSuffix, flags.Lookup(ReadinessMarkerSuffix))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(WatcherBackend, flags.Lookup(WatcherBackend))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(WatcherPollInterval, flags.Lookup(WatcherPollInterval))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(PendingFilesLimit, flags.Lookup(PendingFilesLimit))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(RegistryFlushInterval, flags.Lookup(RegistryFlushInterval))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(RegistryCompactInterval, flags.Lookup(RegistryCompactInterval))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(TailPattern, flags.Lookup(TailPattern))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(TailDelimiter, flags.Lookup(TailDelimiter))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(TailMultilineStart, flags.Lookup(TailMultilineStart))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(TailRecordTimeout, flags.Lookup(TailRecordTimeout))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(Splitter, flags.Lookup(Splitter))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(SplitterOverrides, flags.Lookup(SplitterOverrides))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(SplitterStart, flags.Lookup(SplitterStart))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(SplitterEnd, flags.Lookup(SplitterEnd))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(WalkSchedule, flags.Lookup(WalkSchedule))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(CleanupSchedule, flags.Lookup(CleanupSchedule))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ArchiveSchedule, flags.Lookup(ArchiveSchedule))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(JobJitter, flags.Lookup(JobJitter))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(AdminToken, flags.Lookup(AdminToken))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ArchiveMaxAge, flags.Lookup(ArchiveMaxAge))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ArchiveMaxSize, flags.Lookup(ArchiveMaxSize))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ArchiveMaxCount, flags.Lookup(ArchiveMaxCount))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(BackupMaxAge, flags.Lookup(BackupMaxAge))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(BackupMaxSize, flags.Lookup(BackupMaxSize))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(BackupMaxCount, flags.Lookup(BackupMaxCount))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(DiskHighWatermark, flags.Lookup(DiskHighWatermark))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(DiskLowWatermark, flags.Lookup(DiskLowWatermark))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(DiskWatermarkMinArchives, flags.Lookup(DiskWatermarkMinArchives))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(RetentionSchedule, flags.Lookup(RetentionSchedule))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ArchiveFormat, flags.Lookup(ArchiveFormat))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ArchiveCompressionLevel, flags.Lookup(ArchiveCompressionLevel))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ArchiveMemberNames, flags.Lookup(ArchiveMemberNames))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ArchiveGrouping, flags.Lookup(ArchiveGrouping))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ServiceDiscovery, flags.Lookup(ServiceDiscovery))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(FileSDPath, flags.Lookup(FileSDPath))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(EtcdEndpoints, flags.Lookup(EtcdEndpoints))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(EtcdPrefix, flags.Lookup(EtcdPrefix))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(EtcdTTL, flags.Lookup(EtcdTTL))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(HealthWalkTimeout, flags.Lookup(HealthWalkTimeout))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(HealthUploadTimeout, flags.Lookup(HealthUploadTimeout))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(HealthCheckInterval, flags.Lookup(HealthCheckInterval))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ConsulServiceID, flags.Lookup(ConsulServiceID))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ConsulServiceTags, flags.Lookup(ConsulServiceTags))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ConsulServiceMeta, flags.Lookup(ConsulServiceMeta))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ConsulDeregisterCriticalAfter, flags.Lookup(ConsulDeregisterCriticalAfter))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIConsulService, flags.Lookup(APIConsulService))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(APIConsulTag, flags.Lookup(APIConsulTag))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	err = viper.BindPFlag(ConfigConsulPrefix, flags.Lookup(ConfigConsulPrefix))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 	rootCmd.Version = version.AsString()
 }
 
@@ -130,38 +616,11 @@ var rootCmd = &cobra.Command{
 	Short: "Dump worker",
 	Long:  `Dump worker is utility for processing and send dumps from local machine to central dump server`,
 	Run:   run,
-	PreRun: func(cmd *cobra.Command, args []string) {
-		config.DumpDir = viper.GetString(DumpDir)
-		config.BackupDir = viper.GetString(BackupDir)
-		config.PatternFileFilter = viper.GetString(PatternFileFilter)
-		config.FileWaitTime = viper.GetInt(FileWaitTime)
-		config.APIUrl = viper.GetString(APIUrl)
-		config.APIToken = viper.GetString(APIToken)
-		config.DaysToArchive = viper.GetInt(DaysToArchive)
-		config.NodeName = viper.GetString(NodeName)
-		config.MaxFileSize = viper.GetInt(MaxFileSize)
-		config.Aliases = viper.GetString(Aliases)
-		config.ConsulHost = viper.GetString(ConsulHost)
-		config.ConsulServiceName = viper.GetString(ConsulServiceName)
-		config.ExporterBindAddress = viper.GetString(ExporterBindAddress)
-		config.ExporterBindPort = viper.GetInt(ExporterBindPort)
-		config.LogLevel = viper.GetString(LogLevel)
-		config.AliasesMap = make(map[string]string)
-		if config.Aliases != "" {
-			aliasesSlice := strings.Split(config.Aliases, ",")
-			for _, alias := range aliasesSlice {
-				tmpList := strings.Split(alias, ":")
-				if len(tmpList) == 2 {
-					config.AliasesMap[tmpList[0]] = tmpList[1]
-				}
-			}
-		}
-		if config.NodeName == "" {
-			nodeName, err := os.Hostname()
-			if err != nil {
-				log.Error(fmt.Sprintf("%s. Error get hostname", err.Error()))
-			}
-			config.NodeName = nodeName
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+		root.SetConfig(&config)
+		if config.ConfigConsulPrefix != "" {
+			initRemoteConfig()
 		}
 		err := log.ConfigureLogging()
 		if err != nil {
@@ -172,11 +631,168 @@ var rootCmd = &cobra.Command{
 	Version: "0.1.0",
 }
 
+// loadConfig build configuration from flags, environment and central configuration
+func loadConfig() root.Config {
+	c := root.Config{}
+	c.DumpDir = viper.GetString(DumpDir)
+	c.BackupDir = viper.GetString(BackupDir)
+	c.PatternFileFilter = viper.GetString(PatternFileFilter)
+	c.FileWaitTime = viper.GetInt(FileWaitTime)
+	c.APIUrl = viper.GetString(APIUrl)
+	c.APIToken = viper.GetString(APIToken)
+	c.DaysToArchive = viper.GetInt(DaysToArchive)
+	c.NodeName = viper.GetString(NodeName)
+	c.MaxFileSize = viper.GetInt(MaxFileSize)
+	c.Aliases = viper.GetString(Aliases)
+	c.ConsulHost = viper.GetString(ConsulHost)
+	c.ConsulServiceName = viper.GetString(ConsulServiceName)
+	c.ExporterBindAddress = viper.GetString(ExporterBindAddress)
+	c.ExporterBindPort = viper.GetInt(ExporterBindPort)
+	c.LogLevel = viper.GetString(LogLevel)
+	c.APIConnectTimeout = viper.GetInt(APIConnectTimeout)
+	c.APIResponseTimeout = viper.GetInt(APIResponseTimeout)
+	c.APITimeout = viper.GetInt(APITimeout)
+	c.APIKeepAlive = viper.GetInt(APIKeepAlive)
+	c.APIProxy = viper.GetString(APIProxy)
+	c.APINoProxy = viper.GetString(APINoProxy)
+	c.APIMaxIdleConns = viper.GetInt(APIMaxIdleConns)
+	c.APIMaxIdleConnsPerHost = viper.GetInt(APIMaxIdleConnsPerHost)
+	c.APIMaxConnsPerHost = viper.GetInt(APIMaxConnsPerHost)
+	c.APIIdleConnTimeout = viper.GetInt(APIIdleConnTimeout)
+	c.APISuccessCodes = viper.GetString(APISuccessCodes)
+	c.APIMaxRetries = viper.GetInt(APIMaxRetries)
+	c.APIRetryBackoff = viper.GetInt(APIRetryBackoff)
+	c.APIMaxRetryAfter = viper.GetInt(APIMaxRetryAfter)
+	c.APIRateLimit = viper.GetFloat64(APIRateLimit)
+	c.APIRateBurst = viper.GetInt(APIRateBurst)
+	c.APIBytesRateLimit = viper.GetInt(APIBytesRateLimit)
+	c.CircuitBreakerFailures = viper.GetInt(CircuitBreakerFailures)
+	c.CircuitBreakerOpenTime = viper.GetInt(CircuitBreakerOpenTime)
+	c.CircuitBreakerProbes = viper.GetInt(CircuitBreakerProbes)
+	c.BatchEnabled = viper.GetBool(BatchEnabled)
+	c.BatchMaxCount = viper.GetInt(BatchMaxCount)
+	c.BatchMaxBytes = viper.GetInt(BatchMaxBytes)
+	c.BatchMaxWait = viper.GetInt(BatchMaxWait)
+	c.BatchFormat = viper.GetString(BatchFormat)
+	c.BatchEndpoint = viper.GetString(BatchEndpoint)
+	c.DataDir = viper.GetString(DataDir)
+	c.AckRetention = viper.GetInt(AckRetention)
+	c.ReadinessStrategy = viper.GetString(ReadinessStrategy)
+	c.ReadinessOverrides = viper.GetString(ReadinessOverrides)
+	c.ReadinessQuietPeriod = viper.GetInt(ReadinessQuietPeriod)
+	c.ReadinessStablePolls = viper.GetInt(ReadinessStablePolls)
+	c.ReadinessStableInterval = viper.GetInt(ReadinessStableInterval)
+	c.ReadinessMarkerSuffix = viper.GetString(ReadinessMarkerSuffix)
+	c.WatcherBackend = viper.GetString(WatcherBackend)
+	c.WatcherPollInterval = viper.GetInt(WatcherPollInterval)
+	c.PendingFilesLimit = viper.GetInt(PendingFilesLimit)
+	c.RegistryFlushInterval = viper.GetInt(RegistryFlushInterval)
+	c.RegistryCompactInterval = viper.GetInt(RegistryCompactInterval)
+	c.TailPattern = viper.GetString(TailPattern)
+	c.TailDelimiter = viper.GetString(TailDelimiter)
+	c.TailMultilineStart = viper.GetString(TailMultilineStart)
+	c.TailRecordTimeout = viper.GetInt(TailRecordTimeout)
+	c.Splitter = viper.GetString(Splitter)
+	c.SplitterOverrides = viper.GetString(SplitterOverrides)
+	c.SplitterStart = viper.GetString(SplitterStart)
+	c.SplitterEnd = viper.GetString(SplitterEnd)
+	c.WalkSchedule = viper.GetString(WalkSchedule)
+	c.CleanupSchedule = viper.GetString(CleanupSchedule)
+	c.ArchiveSchedule = viper.GetString(ArchiveSchedule)
+	c.JobJitter = viper.GetInt(JobJitter)
+	c.AdminToken = viper.GetString(AdminToken)
+	c.ArchiveMaxAge = viper.GetInt(ArchiveMaxAge)
+	c.ArchiveMaxSize = viper.GetInt(ArchiveMaxSize)
+	c.ArchiveMaxCount = viper.GetInt(ArchiveMaxCount)
+	c.BackupMaxAge = viper.GetInt(BackupMaxAge)
+	c.BackupMaxSize = viper.GetInt(BackupMaxSize)
+	c.BackupMaxCount = viper.GetInt(BackupMaxCount)
+	c.DiskHighWatermark = viper.GetFloat64(DiskHighWatermark)
+	c.DiskLowWatermark = viper.GetFloat64(DiskLowWatermark)
+	c.DiskWatermarkMinArchives = viper.GetInt(DiskWatermarkMinArchives)
+	c.RetentionSchedule = viper.GetString(RetentionSchedule)
+	c.ArchiveFormat = viper.GetString(ArchiveFormat)
+	c.ArchiveCompressionLevel = viper.GetInt(ArchiveCompressionLevel)
+	c.ArchiveMemberNames = viper.GetString(ArchiveMemberNames)
+	c.ArchiveGrouping = viper.GetString(ArchiveGrouping)
+	c.ServiceDiscovery = viper.GetString(ServiceDiscovery)
+	c.FileSDPath = viper.GetString(FileSDPath)
+	c.EtcdEndpoints = viper.GetString(EtcdEndpoints)
+	c.EtcdPrefix = viper.GetString(EtcdPrefix)
+	c.EtcdTTL = viper.GetInt(EtcdTTL)
+	c.HealthWalkTimeout = viper.GetInt(HealthWalkTimeout)
+	c.HealthUploadTimeout = viper.GetInt(HealthUploadTimeout)
+	c.HealthCheckInterval = viper.GetString(HealthCheckInterval)
+	c.ConsulServiceID = viper.GetString(ConsulServiceID)
+	c.ConsulServiceTags = viper.GetString(ConsulServiceTags)
+	c.ConsulServiceMeta = viper.GetString(ConsulServiceMeta)
+	c.ConsulDeregisterCriticalAfter = viper.GetString(ConsulDeregisterCriticalAfter)
+	c.APIConsulService = viper.GetString(APIConsulService)
+	c.APIConsulTag = viper.GetString(APIConsulTag)
+	c.ConfigConsulPrefix = viper.GetString(ConfigConsulPrefix)
+	c.AliasesMap = make(map[string]string)
+	if c.Aliases != "" {
+		aliasesSlice := strings.Split(c.Aliases, ",")
+		for _, alias := range aliasesSlice {
+			tmpList := strings.Split(alias, ":")
+			if len(tmpList) == 2 {
+				c.AliasesMap[tmpList[0]] = tmpList[1]
+			}
+		}
+	}
+	c.ReadinessMap = make(map[string]string)
+	if c.ReadinessOverrides != "" {
+		for _, override := range strings.Split(c.ReadinessOverrides, ",") {
+			tmpList := strings.Split(override, ":")
+			if len(tmpList) == 2 {
+				c.ReadinessMap[tmpList[0]] = tmpList[1]
+			}
+		}
+	}
+	c.SplitterMap = make(map[string]string)
+	if c.SplitterOverrides != "" {
+		for _, override := range strings.Split(c.SplitterOverrides, ",") {
+			tmpList := strings.Split(override, ":")
+			if len(tmpList) == 2 {
+				c.SplitterMap[tmpList[0]] = tmpList[1]
+			}
+		}
+	}
+	c.ConsulServiceMetaMap = make(map[string]string)
+	if c.ConsulServiceMeta != "" {
+		for _, meta := range strings.Split(c.ConsulServiceMeta, ",") {
+			tmpList := strings.SplitN(meta, ":", 2)
+			if len(tmpList) == 2 {
+				c.ConsulServiceMetaMap[strings.TrimSpace(tmpList[0])] = strings.TrimSpace(tmpList[1])
+			}
+		}
+	}
+	if c.NodeName == "" {
+		nodeName, err := os.Hostname()
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error get hostname", err.Error()))
+		}
+		c.NodeName = nodeName
+	}
+	return c
+}
+
 func run(_ *cobra.Command, _ []string) {
-	consulClient, err := consul.NewConsulClient(config.ConsulHost)
+	config := root.GetConfig()
+	registry, err := discovery.New(config)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "Cannot register consul"))
+		log.Fatal(err.Error())
 	}
+	jobs, err := newScheduler()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if config.AdminToken == "" {
+		log.Info(fmt.Sprintf("Admin token is not set, %s endpoints are disabled", scheduler.AdminPath))
+	}
+	http.Handle(scheduler.AdminPath+"/", jobs.Handler(config.AdminToken))
+	http.Handle(scheduler.AdminPath, jobs.Handler(config.AdminToken))
+	http.Handle(health.Path, health.Handler())
 	go func() {
 		err := exporter.StartExporter(config.ExporterBindPort)
 		if err != nil {
@@ -186,46 +802,132 @@ func run(_ *cobra.Command, _ []string) {
 	go func() {
 		exporter.CountUnprocessedFilesGaugeHandler(config.DumpDir)
 	}()
-	err = consulClient.Register(config.ConsulServiceName, config.ExporterBindAddress, config.ExporterBindPort)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	log.Info(fmt.Sprintf("Service %s registered in consul", config.ConsulServiceName))
-	consulDeRegister := func() {
-		err := consulClient.DeRegister(config.ConsulServiceName)
+	go register(registry)
+	deRegister := func() {
+		err := registry.DeRegister(config.ConsulServiceName)
 		if err != nil {
-			log.Fatal(err.Error())
+			log.Error(fmt.Sprintf("%s. Error de-register service %s", err.Error(), config.ConsulServiceName))
+			return
 		}
-		log.Info(fmt.Sprintf("Service %s de-registered in consul", config.ConsulServiceName))
+		log.Info(fmt.Sprintf("Service %s de-registered in %s", config.ConsulServiceName, config.ServiceDiscovery))
 	}
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt)
 	go func() {
 		<-signalChan
 		log.Info("Received an interrupt, stopping services...")
-		consulDeRegister()
+		dump.FlushBatches()
+		checkpoint.Sync()
+		deRegister()
 		os.Exit(0)
 	}()
 	defer func() {
-		consulDeRegister()
+		deRegister()
 	}()
 
 	go watcher.FSWatch()
-	for {
-		err := filepath.Walk(config.DumpDir, dump.VisitFileWithWaitTime)
+	go watchRemoteConfig()
+	jobs.Start()
+	select {}
+}
+
+// newScheduler create jobs of dump directory walk, cleanup, archiving and retention with configured schedules
+func newScheduler() (*scheduler.Scheduler, error) {
+	config := root.GetConfig()
+	jobs := scheduler.New()
+	// Cleanup must not delete folders which are being walked, retention must not delete
+	// backups and archives which are being merged into archive
+	dumpLock := &sync.Mutex{}
+	backupLock := &sync.Mutex{}
+	for _, job := range []struct {
+		name string
+		spec string
+		lock sync.Locker
+		run  func() error
+	}{
+		{"walk", config.WalkSchedule, dumpLock, func() error {
+			err := filepath.Walk(root.GetConfig().DumpDir, dump.VisitFileWithWaitTime)
+			if err == nil {
+				health.Walked()
+			}
+			return err
+		}},
+		{"cleanup", config.CleanupSchedule, dumpLock, func() error {
+			return common.CleanupEmptyFolders(root.GetConfig().DumpDir)
+		}},
+		{"archive", config.ArchiveSchedule, backupLock, func() error {
+			config := root.GetConfig()
+			return common.ArchiveDumps(config.BackupDir, config.PatternFileFilter, config.DaysToArchive, archiveOptions())
+		}},
+		{"retention", config.RetentionSchedule, backupLock, func() error {
+			config := root.GetConfig()
+			return common.ApplyRetention(config.BackupDir, common.RetentionPolicy{
+				Archives:          common.RetentionRule{MaxAge: config.ArchiveMaxAge, MaxSize: config.ArchiveMaxSize, MaxCount: config.ArchiveMaxCount},
+				Backups:           common.RetentionRule{MaxAge: config.BackupMaxAge, MaxSize: config.BackupMaxSize, MaxCount: config.BackupMaxCount},
+				PatternFileFilter: config.PatternFileFilter,
+				HighWatermark:     config.DiskHighWatermark,
+				LowWatermark:      config.DiskLowWatermark,
+				MinArchives:       config.DiskWatermarkMinArchives,
+			})
+		}},
+	} {
+		schedule, err := scheduler.Parse(job.spec)
 		if err != nil {
-			log.Fatal(err.Error())
+			return nil, errors.Wrapf(err, "Error parse schedule of job %s", job.name)
 		}
-		err = common.CleanupEmptyFolders(config.DumpDir)
-		if err != nil {
-			log.Fatal(err.Error())
+		jobs.Add(&scheduler.Job{
+			Name:     job.name,
+			Schedule: schedule,
+			Jitter:   time.Duration(config.JobJitter) * time.Second,
+			Run:      job.run,
+			Lock:     job.lock,
+		})
+	}
+	return jobs, nil
+}
+
+// archiveOptions return format, compression level, member names and grouping of archives from config
+func archiveOptions() common.ArchiveOptions {
+	config := root.GetConfig()
+	return common.ArchiveOptions{
+		Format:      config.ArchiveFormat,
+		Level:       config.ArchiveCompressionLevel,
+		MemberNames: config.ArchiveMemberNames,
+		Grouping:    config.ArchiveGrouping,
+	}
+}
+
+// register service in discovery backend, retrying until it succeeds. Then report upload health
+func register(registry discovery.Registry) {
+	config := root.GetConfig()
+	for {
+		err := registry.Register(config.ConsulServiceName, config.ExporterBindAddress, config.ExporterBindPort)
+		if err == nil {
+			break
 		}
+		log.Error(fmt.Sprintf("%s. Error register service %s in %s, retry in 30s", err.Error(), config.ConsulServiceName, config.ServiceDiscovery))
+		<-time.After(30 * time.Second)
+	}
+	log.Info(fmt.Sprintf("Service %s (instance %s) registered in %s", config.ConsulServiceName,
+		discovery.InstanceID(config), config.ServiceDiscovery))
+	reportUploadHealth(registry)
+}
 
-		err = common.ArchiveDumps(config.BackupDir, config.PatternFileFilter, config.DaysToArchive)
-		if err != nil {
-			log.Fatal(err.Error())
+// reportUploadHealth refresh service health while walker and uploads make progress. Without progress
+// health is not refreshed, so consul TTL check expires and becomes critical
+func reportUploadHealth(registry discovery.Registry) {
+	config := root.GetConfig()
+	for {
+		report := health.Status()
+		if report.Status == health.StatusCritical {
+			log.Error(fmt.Sprintf("Service is not healthy, health is not refreshed: %s", report.Output))
+		} else {
+			err := registry.UpdateHealth(config.ConsulServiceName, report.Status, report.Output)
+			if err != nil {
+				log.Error(fmt.Sprintf("%s. Error update service health", err.Error()))
+			}
 		}
-		time.Sleep(time.Duration(120) * time.Second)
+		<-time.After(30 * time.Second)
 	}
 }
 
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/checkpoint"
+	"dumpbeat/pkg/common"
+	"dumpbeat/pkg/dump"
+	"dumpbeat/pkg/log"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+const (
+	exitDumpsFailed = 1
+	exitError       = 2
+)
+
+var (
+	onceNoWait    bool
+	onceNoArchive bool
+)
+
+func init() {
+	flags := onceCmd.Flags()
+	flags.BoolVar(&onceNoWait, "no-wait", false, "Send all dumps without waiting until they are completely written")
+	flags.BoolVar(&onceNoArchive, "no-archive", false, "Don't archive backup directory after sending")
+	rootCmd.AddCommand(onceCmd)
+}
+
+var onceCmd = &cobra.Command{
+	Use:   "once",
+	Short: "Send dumps once and exit",
+	Long: `Walk dump directory once, send dumps, move them to backup directory and archive it.
+Exporter and consul registration are not started, dumps are sent one by one without batching.
+Exit status is 0 when all dumps are sent, 1 when some dumps are not sent and 2 on other errors`,
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		os.Exit(runOnce())
+	},
+}
+
+// runOnce send dumps, archive backup directory and return exit status
+func runOnce() int {
+	onceConfig := *root.GetConfig()
+	onceConfig.BatchEnabled = false
+	root.SetConfig(&onceConfig)
+	config := root.GetConfig()
+	status := 0
+	summary, err := dump.WalkOnce(config.DumpDir, !onceNoWait)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Error walk dump directory %s", err.Error(), config.DumpDir))
+		status = exitError
+	}
+	err = common.CleanupEmptyFolders(config.DumpDir)
+	if err != nil {
+		log.Error(err.Error())
+	}
+	if !onceNoArchive {
+		err = common.ArchiveDumps(config.BackupDir, config.PatternFileFilter, config.DaysToArchive, archiveOptions())
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error archive backup directory %s", err.Error(), config.BackupDir))
+			status = exitError
+		}
+	}
+	checkpoint.Sync()
+	fmt.Printf("Sent %d dumps and %d tail records, skipped %d already sent, failed %d, not ready %d\n",
+		summary.Sent, summary.Records, summary.Skipped, summary.Failed, summary.NotReady)
+	if status == 0 && summary.Failed > 0 {
+		status = exitDumpsFailed
+	}
+	return status
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/common"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rejectingAPI accept dumps with 201 and reject dumps with "bad" in file name with 400
+func rejectingAPI() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Filename string `json:"filename"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if strings.Contains(payload.Filename, "bad") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+}
+
+func TestRunOnce(t *testing.T) {
+	api := rejectingAPI()
+	defer api.Close()
+	tmpDir, err := ioutil.TempDir("", "once")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	old := time.Now().AddDate(0, 0, -3)
+	tests := []struct {
+		name    string
+		dumps   []string
+		backups []string
+		corrupt bool
+		status  int
+	}{
+		{"all sent", []string{"app/a.txt", "app/b.txt"}, nil, false, 0},
+		{"nothing to send", nil, nil, false, 0},
+		{"dump rejected", []string{"app/a.txt", "app/bad.txt"}, nil, false, exitDumpsFailed},
+		{"archived", []string{"app/a.txt"}, []string{"app/old.txt"}, false, 0},
+		{"archive failed", []string{"app/a.txt"}, []string{"app/old.txt"}, true, exitError},
+		{"archive failed and dump rejected", []string{"app/bad.txt"}, []string{"app/old.txt"}, true, exitError},
+	}
+	for i, test := range tests {
+		dir := filepath.Join(tmpDir, strings.Replace(test.name, " ", "_", -1))
+		config := loadConfig()
+		config.DumpDir = filepath.Join(dir, "dumps")
+		config.BackupDir = filepath.Join(dir, "backup")
+		config.DataDir = filepath.Join(tmpDir, "data")
+		config.APIUrl = api.URL
+		config.PatternFileFilter = "*.txt"
+		config.DaysToArchive = 1
+		config.APIMaxRetries = 0
+		root.SetConfig(&config)
+		onceNoWait = true
+		onceNoArchive = false
+		for _, name := range test.dumps {
+			// Content differs between cases, so dumps are not skipped as already sent
+			writeOnceFile(t, filepath.Join(config.DumpDir, name), test.name+name, time.Now())
+		}
+		for _, name := range test.backups {
+			writeOnceFile(t, filepath.Join(config.BackupDir, name), name, old)
+		}
+		archivePath := filepath.Join(config.BackupDir, old.Format("2006-01-02")+"."+common.FormatTarGz)
+		if test.corrupt {
+			writeOnceFile(t, archivePath, "not an archive", old)
+		}
+
+		if status := runOnce(); status != test.status {
+			t.Errorf("case %d %s: exit status %d, expected %d", i, test.name, status, test.status)
+		}
+		for _, name := range test.dumps {
+			_, err := os.Stat(filepath.Join(config.DumpDir, name))
+			if !os.IsNotExist(err) {
+				t.Errorf("case %d %s: dump %s is not moved from dump directory", i, test.name, name)
+			}
+		}
+		if len(test.backups) > 0 && !test.corrupt {
+			if _, err := os.Stat(archivePath); err != nil {
+				t.Errorf("case %d %s: archive is not created: %v", i, test.name, err)
+			}
+		}
+	}
+}
+
+func writeOnceFile(t *testing.T, fileName, content string, modTime time.Time) {
+	err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(fileName, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(fileName, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
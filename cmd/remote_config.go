@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/consul"
+	"dumpbeat/pkg/dump"
+	"dumpbeat/pkg/kvconfig"
+	"dumpbeat/pkg/log"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// localOnlySettings locate central configuration, so they are not taken from it
+var localOnlySettings = map[string]bool{
+	ConfigConsulPrefix: true,
+	ConsulHost:         true,
+	NodeName:           true,
+	DataDir:            true,
+}
+
+// restartSettings are read once on start, their changes are applied after restart
+var restartSettings = map[string]bool{
+	DumpDir:             true,
+	BackupDir:           true,
+	ExporterBindAddress: true,
+	ExporterBindPort:    true,
+	WatcherBackend:      true,
+	WatcherPollInterval: true,
+	WalkSchedule:        true,
+	CleanupSchedule:     true,
+	ArchiveSchedule:     true,
+	RetentionSchedule:   true,
+	JobJitter:           true,
+	ServiceDiscovery:    true,
+	ConsulServiceName:   true,
+	ConsulServiceID:     true,
+	APIConsulService:    true,
+	APIRateLimit:        true,
+	APIRateBurst:        true,
+	APIBytesRateLimit:   true,
+	APIConnectTimeout:   true,
+	APIResponseTimeout:  true,
+	APITimeout:          true,
+	APIKeepAlive:        true,
+	APIProxy:            true,
+	APINoProxy:          true,
+}
+
+var (
+	remoteSource *kvconfig.Source
+	remoteIndex  uint64
+	remoteValues kvconfig.Values
+	remoteKeys   = make(map[string]bool)
+	remoteFlags  *pflag.FlagSet
+)
+
+func init() {
+	remoteFlags = rootCmd.PersistentFlags()
+}
+
+// initRemoteConfig apply central configuration from consul KV. When consul is unreachable last
+// applied configuration is taken from cache
+func initRemoteConfig() {
+	config := root.GetConfig()
+	client, err := consul.NewConsulClient(config.ConsulHost)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Error create consul client, using local configuration", err.Error()))
+		return
+	}
+	remoteSource = kvconfig.New(client, config.ConfigConsulPrefix, config.NodeName, config.DataDir)
+	values, index, err := remoteSource.Load(0)
+	fromCache := false
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Error read configuration from consul, using cached configuration", err.Error()))
+		values, err = remoteSource.ReadCache()
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Using local configuration", err.Error()))
+			return
+		}
+		fromCache = true
+	}
+	remoteIndex = index
+	remoteValues = values
+	err = applyRemoteConfig(values)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Configuration from consul is not applied", err.Error()))
+		return
+	}
+	reloaded := loadConfig()
+	root.SetConfig(&reloaded)
+	if fromCache {
+		log.Info(fmt.Sprintf("Cached configuration applied, %d settings", len(values)))
+		return
+	}
+	log.Info(fmt.Sprintf("Configuration from consul %s applied, %d settings", config.ConfigConsulPrefix, len(values)))
+	err = remoteSource.WriteCache(values)
+	if err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// watchRemoteConfig apply changes of central configuration while agent is running
+func watchRemoteConfig() {
+	if remoteSource == nil {
+		return
+	}
+	remoteSource.Watch(remoteIndex, remoteValues, reloadConfig)
+}
+
+// reloadConfig apply changed central configuration to running agent
+func reloadConfig(values kvconfig.Values) error {
+	previous := settings()
+	err := applyRemoteConfig(values)
+	if err != nil {
+		return err
+	}
+	reloaded := loadConfig()
+	root.SetConfig(&reloaded)
+	dump.ResetSplitters()
+	err = log.ConfigureLogging()
+	if err != nil {
+		log.Error(err.Error())
+	}
+	current := settings()
+	var changed, restart []string
+	for name, value := range current {
+		if previous[name] == value {
+			continue
+		}
+		changed = append(changed, name)
+		if restartSettings[name] {
+			restart = append(restart, name)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(restart)
+	log.Info(fmt.Sprintf("Configuration from consul applied, changed settings: %s", strings.Join(changed, ", ")))
+	if len(restart) > 0 {
+		log.Info(fmt.Sprintf("Changes of %s are applied after restart", strings.Join(restart, ", ")))
+	}
+	return nil
+}
+
+// applyRemoteConfig validate values and set them as defaults, so flags and environment set on node
+// take precedence. Settings removed from consul return to flag defaults
+func applyRemoteConfig(values kvconfig.Values) error {
+	flags := remoteFlags
+	keys := make(map[string]bool)
+	for name, value := range values {
+		flag := flags.Lookup(name)
+		if flag == nil || localOnlySettings[name] {
+			log.Error(fmt.Sprintf("Setting %s can not be set in consul, skipped", name))
+			continue
+		}
+		err := validateSetting(flag.Value.Type(), value)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid value %q of %s", value, name)
+		}
+		keys[name] = true
+	}
+	for name := range remoteKeys {
+		if !keys[name] {
+			viper.SetDefault(name, flags.Lookup(name).DefValue)
+		}
+	}
+	for name := range keys {
+		viper.SetDefault(name, values[name])
+	}
+	remoteKeys = keys
+	return nil
+}
+
+func validateSetting(kind, value string) error {
+	var err error
+	switch kind {
+	case "int":
+		_, err = strconv.Atoi(value)
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	case "float64":
+		_, err = strconv.ParseFloat(value, 64)
+	}
+	return err
+}
+
+// settings return current value of every flag
+func settings() map[string]string {
+	values := make(map[string]string)
+	for _, name := range viper.AllKeys() {
+		values[name] = fmt.Sprint(viper.Get(name))
+	}
+	return values
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/common"
+	"dumpbeat/pkg/dump"
+	"dumpbeat/pkg/limiter"
+	"dumpbeat/pkg/log"
+	"encoding/hex"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	replaySourceAll     = "all"
+	replaySourceBackup  = "backup"
+	replaySourceArchive = "archive"
+)
+
+var (
+	replayFilter archiveFilter
+	replaySource string
+	replayDryRun bool
+	replayRate   float64
+)
+
+func init() {
+	flags := replayCmd.Flags()
+	addFilterFlags(flags, &replayFilter)
+	flags.StringVar(&replaySource, "source", replaySourceAll, "Source of dumps: all, backup or archive")
+	flags.BoolVar(&replayDryRun, "dry-run", false, "Print dumps which would be sent without sending them")
+	flags.Float64Var(&replayRate, "rate", 0, "Maximum dumps sent per second (0 - only api_rate_limit applies)")
+	rootCmd.AddCommand(replayCmd)
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay [pattern]",
+	Short: "Send again dumps from backup directory and archives",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		if replaySource != replaySourceAll && replaySource != replaySourceBackup && replaySource != replaySourceArchive {
+			log.Fatal(fmt.Sprintf("Unknown replay source %s, expected all, backup or archive", replaySource))
+		}
+		r := &replayer{}
+		if replayRate > 0 {
+			r.bucket = limiter.NewTokenBucket(replayRate, 1)
+		}
+		if replaySource != replaySourceArchive {
+			r.replayBackups(args)
+		}
+		if replaySource != replaySourceBackup {
+			r.replayArchives(args)
+		}
+		action := "Sent"
+		if replayDryRun {
+			action = "Would send"
+		}
+		fmt.Printf("%s %d dumps, failed %d\n", action, r.sent, r.failed)
+		if r.failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+type replayer struct {
+	bucket *limiter.TokenBucket
+	sent   int
+	failed int
+}
+
+// replayBackups send not archived dumps of backup directory
+func (r *replayer) replayBackups(args []string) {
+	config := root.GetConfig()
+	pattern := ""
+	if len(args) > 0 {
+		pattern = args[0]
+	}
+	since, until, err := replayFilter.dates()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	rootDir := filepath.Clean(config.BackupDir)
+	err = filepath.Walk(rootDir, func(fileName string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			log.Error(err.Error())
+			return nil
+		}
+		if fileInfo.IsDir() || filepath.Dir(fileName) == rootDir {
+			// Archives and indexes are stored in root of backup directory
+			return nil
+		}
+		if matched, _ := filepath.Match(config.PatternFileFilter, fileInfo.Name()); !matched {
+			return nil
+		}
+		relPath, err := filepath.Rel(rootDir, fileName)
+		if err != nil {
+			return nil
+		}
+		member := common.IndexMember{
+			Name:    filepath.ToSlash(relPath),
+			App:     strings.SplitN(filepath.ToSlash(relPath), "/", 2)[0],
+			Size:    fileInfo.Size(),
+			ModTime: fileInfo.ModTime(),
+		}
+		filter := replayFilter
+		filter.hash = ""
+		if !filter.matches(member, pattern, since, until) {
+			return nil
+		}
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error read %s", err.Error(), fileName))
+			r.failed++
+			return nil
+		}
+		if replayFilter.hash != "" {
+			hash := sha256.Sum256(content)
+			if !strings.HasPrefix(hex.EncodeToString(hash[:]), strings.ToLower(replayFilter.hash)) {
+				return nil
+			}
+		}
+		r.replay(fileName, member, content)
+		return nil
+	})
+	if err != nil {
+		log.Error(err.Error())
+	}
+}
+
+// replayArchives send dumps of archives selected by indexes
+func (r *replayer) replayArchives(args []string) {
+	matches := searchArchives(replayFilter, args)
+	for _, archive := range matches.archives {
+		members := make(map[string]common.IndexMember)
+		names := make(map[string]bool)
+		for _, member := range matches.members[archive] {
+			members[member.Name] = member
+			names[member.Name] = true
+		}
+		err := common.ReadMembers(archive, names, func(name string, reader io.Reader) error {
+			content, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return err
+			}
+			r.replay(fmt.Sprintf("%s:%s", filepath.Base(archive), name), members[name], content)
+			return nil
+		})
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error read archive %s", err.Error(), archive))
+			r.failed++
+		}
+	}
+}
+
+// replay send dump under its original path in dump directory
+func (r *replayer) replay(source string, member common.IndexMember, content []byte) {
+	config := root.GetConfig()
+	name := member.Name
+	if filepath.IsAbs(name) {
+		if relPath, err := filepath.Rel(config.BackupDir, name); err == nil {
+			name = relPath
+		}
+	}
+	fileName := filepath.Join(config.DumpDir, filepath.FromSlash(name))
+	if replayDryRun {
+		fmt.Printf("%s -> %s\n", source, fileName)
+		r.sent++
+		return
+	}
+	if r.bucket != nil {
+		r.bucket.Wait(1)
+	}
+	err := dump.Replay(fileName, content, member.ModTime)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Error replay %s", err.Error(), source))
+		r.failed++
+		return
+	}
+	fmt.Printf("%s -> %s\n", source, fileName)
+	r.sent++
+}
@@ -6,9 +6,12 @@ require (
 	github.com/fsnotify/fsnotify v1.4.7
 	github.com/hashicorp/consul/api v1.2.0
 	github.com/hashicorp/go-rootcerts v1.0.1
+	github.com/klauspost/compress v1.11.13
 	github.com/pkg/errors v0.8.1
 	github.com/prometheus/client_golang v0.9.3
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v0.0.5
+	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.4.0
+	github.com/ulikunitz/xz v0.5.10
 )
@@ -0,0 +1,297 @@
+package checkpoint
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/log"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const fileName = "registry.json"
+
+// Status of dump file delivery
+type Status string
+
+const (
+	// StatusPending file is being sent
+	StatusPending Status = "pending"
+	// StatusSent file is accepted by API but not moved to backup directory yet
+	StatusSent Status = "sent"
+	// StatusTail file is append-only dump log, offset points after last sent record
+	StatusTail Status = "tail"
+)
+
+// Entry is state of one file in dump directory
+type Entry struct {
+	Path    string    `json:"path"`
+	Device  uint64    `json:"device"`
+	Inode   uint64    `json:"inode"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"hash,omitempty"`
+	Offset  int64     `json:"offset,omitempty"`
+	Status  Status    `json:"status"`
+	Updated time.Time `json:"updated"`
+}
+
+// state is content of registry file
+type state struct {
+	Entries []*Entry         `json:"entries"`
+	Acks    map[string]int64 `json:"acks"`
+}
+
+// Registry keeps state of dump files and idempotency keys acknowledged by API across restarts.
+// Changes are written to disk by periodic flush
+type Registry struct {
+	path         string
+	entries      map[string]*Entry
+	acks         map[string]time.Time
+	ackRetention time.Duration
+	dirty        bool
+	lastCompact  time.Time
+	mux          sync.Mutex
+}
+
+var (
+	registry     *Registry
+	registryOnce sync.Once
+)
+
+func getRegistry() *Registry {
+	registryOnce.Do(func() {
+		config := root.GetConfig()
+		registry = &Registry{
+			path:         filepath.Join(config.DataDir, fileName),
+			entries:      make(map[string]*Entry),
+			acks:         make(map[string]time.Time),
+			ackRetention: time.Duration(config.AckRetention) * time.Hour,
+			lastCompact:  time.Now(),
+		}
+		err := registry.load()
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error load registry, starting with empty state", err.Error()))
+		}
+		go registry.run(time.Duration(config.RegistryFlushInterval)*time.Second, time.Duration(config.RegistryCompactInterval)*time.Second)
+	})
+	return registry
+}
+
+// NewEntry create entry with identity of file
+func NewEntry(fileName string, fileInfo os.FileInfo, hash string) Entry {
+	device, inode := fileIdentity(fileInfo)
+	return Entry{
+		Path:    fileName,
+		Device:  device,
+		Inode:   inode,
+		Size:    fileInfo.Size(),
+		ModTime: fileInfo.ModTime(),
+		Hash:    hash,
+	}
+}
+
+// SameFile report whether entry describes the same unchanged file
+func (e Entry) SameFile(other Entry) bool {
+	if e.Device != other.Device || e.Inode != other.Inode || e.Size != other.Size || !e.ModTime.Equal(other.ModTime) {
+		return false
+	}
+	return e.Hash == "" || other.Hash == "" || e.Hash == other.Hash
+}
+
+// Get return state of file
+func Get(fileName string) (Entry, bool) {
+	r := getRegistry()
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	entry, ok := r.entries[fileName]
+	if !ok {
+		return Entry{}, false
+	}
+	return *entry, true
+}
+
+// Set save state of file
+func Set(entry Entry, status Status) {
+	r := getRegistry()
+	entry.Status = status
+	entry.Updated = time.Now()
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.entries[entry.Path] = &entry
+	r.dirty = true
+}
+
+// Acknowledged report whether dump with idempotency key was already accepted by API
+func Acknowledged(key string) bool {
+	r := getRegistry()
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	_, ok := r.acks[key]
+	return ok
+}
+
+// Acknowledge save idempotency key of dump accepted by API
+func Acknowledge(key string) {
+	if key == "" {
+		return
+	}
+	r := getRegistry()
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.acks[key]; !ok {
+		r.acks[key] = time.Now()
+		r.dirty = true
+	}
+}
+
+// Delete forget file moved out of dump directory
+func Delete(fileName string) {
+	r := getRegistry()
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.entries[fileName]; ok {
+		delete(r.entries, fileName)
+		r.dirty = true
+	}
+}
+
+// Sync write registry to disk if it was changed
+func Sync() {
+	if registry == nil {
+		return
+	}
+	err := registry.flush()
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Error write registry", err.Error()))
+	}
+}
+
+func (r *Registry) run(flushInterval, compactInterval time.Duration) {
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	for {
+		<-time.After(flushInterval)
+		if compactInterval > 0 && time.Since(r.lastCompact) >= compactInterval {
+			r.compact()
+		}
+		Sync()
+	}
+}
+
+// compact drop entries of files which disappeared or were replaced and expired acknowledged keys
+func (r *Registry) compact() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.ackRetention > 0 {
+		for key, ts := range r.acks {
+			if time.Since(ts) > r.ackRetention {
+				delete(r.acks, key)
+				r.dirty = true
+			}
+		}
+	}
+	for name, entry := range r.entries {
+		fileInfo, err := os.Stat(name)
+		if err == nil && entry.Status == StatusTail {
+			current := NewEntry(name, fileInfo, "")
+			if current.Device == entry.Device && current.Inode == entry.Inode {
+				continue
+			}
+		}
+		if err != nil || !NewEntry(name, fileInfo, "").SameFile(*entry) {
+			delete(r.entries, name)
+			r.dirty = true
+		}
+	}
+	r.lastCompact = time.Now()
+}
+
+func (r *Registry) load() error {
+	content, err := ioutil.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Error read file %s", r.path)
+	}
+	var current state
+	err = json.Unmarshal(content, &current)
+	if err != nil {
+		return errors.Wrapf(err, "Error parse file %s", r.path)
+	}
+	for _, entry := range current.Entries {
+		r.entries[entry.Path] = entry
+	}
+	for key, ts := range current.Acks {
+		r.acks[key] = time.Unix(ts, 0)
+	}
+	r.compact()
+	return nil
+}
+
+// flush atomically replace registry file with current state
+func (r *Registry) flush() error {
+	r.mux.Lock()
+	if !r.dirty {
+		r.mux.Unlock()
+		return nil
+	}
+	current := state{
+		Entries: make([]*Entry, 0, len(r.entries)),
+		Acks:    make(map[string]int64, len(r.acks)),
+	}
+	for _, entry := range r.entries {
+		copied := *entry
+		current.Entries = append(current.Entries, &copied)
+	}
+	for key, ts := range r.acks {
+		current.Acks[key] = ts.Unix()
+	}
+	r.dirty = false
+	r.mux.Unlock()
+	content, err := json.Marshal(current)
+	if err == nil {
+		err = writeFileAtomic(r.path, content)
+	}
+	if err != nil {
+		r.mux.Lock()
+		r.dirty = true
+		r.mux.Unlock()
+	}
+	return err
+}
+
+func writeFileAtomic(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return errors.Wrapf(err, "Error create dir %s", dir)
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "Error create temp file in %s", dir)
+	}
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrapf(err, "Error write %s", tmp.Name())
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrapf(err, "Error rename %s to %s", tmp.Name(), path)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package checkpoint
+
+import (
+	root "dumpbeat/pkg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestRegistry(dir string, ackRetention time.Duration) *Registry {
+	return &Registry{
+		path:         filepath.Join(dir, fileName),
+		entries:      make(map[string]*Entry),
+		acks:         make(map[string]time.Time),
+		ackRetention: ackRetention,
+	}
+}
+
+func writeTestFile(t *testing.T, fileName, content string) os.FileInfo {
+	err := ioutil.WriteFile(fileName, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileInfo
+}
+
+func TestRegistryFlushAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sentFile := filepath.Join(dir, "sent.txt")
+	tailFile := filepath.Join(dir, "tail.log")
+	changedFile := filepath.Join(dir, "changed.txt")
+	goneFile := filepath.Join(dir, "gone.txt")
+	sent := NewEntry(sentFile, writeTestFile(t, sentFile, "sent"), "hash")
+	sent.Status = StatusSent
+	tail := NewEntry(tailFile, writeTestFile(t, tailFile, "record\n"), "")
+	tail.Status = StatusTail
+	tail.Offset = 7
+	changed := NewEntry(changedFile, writeTestFile(t, changedFile, "old"), "")
+	changed.Status = StatusSent
+	gone := NewEntry(goneFile, writeTestFile(t, goneFile, "gone"), "")
+	gone.Status = StatusPending
+
+	r := newTestRegistry(dir, time.Hour)
+	for _, entry := range []Entry{sent, tail, changed, gone} {
+		entry := entry
+		r.entries[entry.Path] = &entry
+	}
+	r.acks["fresh"] = time.Now()
+	r.acks["expired"] = time.Now().Add(-2 * time.Hour)
+	r.dirty = true
+	if err = r.flush(); err != nil {
+		t.Fatalf("flush returned error %v", err)
+	}
+	if r.dirty {
+		t.Error("registry is dirty after flush")
+	}
+
+	// Tail file grows, changed file is rewritten, gone file is removed while agent is stopped
+	if err = ioutil.WriteFile(tailFile, []byte("record\nnext\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, changedFile, "new content")
+	if err = os.Remove(goneFile); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newTestRegistry(dir, time.Hour)
+	if err = loaded.load(); err != nil {
+		t.Fatalf("load returned error %v", err)
+	}
+	tests := []struct {
+		path   string
+		kept   bool
+		status Status
+		offset int64
+	}{
+		{sentFile, true, StatusSent, 0},
+		{tailFile, true, StatusTail, 7},
+		{changedFile, false, "", 0},
+		{goneFile, false, "", 0},
+	}
+	for _, test := range tests {
+		entry, ok := loaded.entries[test.path]
+		if ok != test.kept {
+			t.Errorf("entry of %s kept %v, expected %v", test.path, ok, test.kept)
+			continue
+		}
+		if ok && (entry.Status != test.status || entry.Offset != test.offset) {
+			t.Errorf("entry of %s has status %s offset %d, expected %s %d", test.path, entry.Status, entry.Offset, test.status, test.offset)
+		}
+	}
+	if _, ok := loaded.acks["fresh"]; !ok {
+		t.Error("fresh acknowledged key is not loaded")
+	}
+	if _, ok := loaded.acks["expired"]; ok {
+		t.Error("expired acknowledged key is loaded")
+	}
+}
+
+func TestAcknowledge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := *root.GetConfig()
+	config.DataDir = dir
+	config.AckRetention = 1
+	config.RegistryFlushInterval = 3600
+	root.SetConfig(&config)
+
+	if Acknowledged("key") {
+		t.Error("key is acknowledged before Acknowledge")
+	}
+	Acknowledge("key")
+	Acknowledge("")
+	if !Acknowledged("key") {
+		t.Error("key is not acknowledged after Acknowledge")
+	}
+	if Acknowledged("") {
+		t.Error("empty key is acknowledged")
+	}
+	Sync()
+	loaded := newTestRegistry(dir, time.Hour)
+	if err = loaded.load(); err != nil {
+		t.Fatalf("load returned error %v", err)
+	}
+	if len(loaded.acks) != 1 {
+		t.Errorf("registry file has acknowledged keys %v, expected only key", loaded.acks)
+	}
+	if _, ok := loaded.acks["key"]; !ok {
+		t.Error("acknowledged key is not written by Sync")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package checkpoint
+
+import (
+	"os"
+	"syscall"
+)
+
+func fileIdentity(fileInfo os.FileInfo) (uint64, uint64) {
+	if stat, ok := fileInfo.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev), uint64(stat.Ino)
+	}
+	return 0, 0
+}
@@ -0,0 +1,7 @@
+package checkpoint
+
+import "os"
+
+func fileIdentity(os.FileInfo) (uint64, uint64) {
+	return 0, 0
+}
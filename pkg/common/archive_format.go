@@ -0,0 +1,249 @@
+package common
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatTarGz is gzip compressed tar
+	FormatTarGz = "tar.gz"
+	// FormatTarZst is zstandard compressed tar
+	FormatTarZst = "tar.zst"
+	// FormatTarXz is xz compressed tar
+	FormatTarXz = "tar.xz"
+	// FormatZip is zip with deflate compression
+	FormatZip = "zip"
+)
+
+// ArchiveFormats supported by archiving
+var ArchiveFormats = []string{FormatTarGz, FormatTarZst, FormatTarXz, FormatZip}
+
+// xzDictCaps are dictionary sizes of xz presets 0-9
+var xzDictCaps = []int{256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// archiveMember is file stored in archive
+type archiveMember struct {
+	Name    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+type archiveWriter interface {
+	WriteMember(member archiveMember, r io.Reader) error
+	Close() error
+}
+
+// archiveReadError means archive content can't be read
+type archiveReadError struct {
+	error
+}
+
+// archiveFormat return format of archive by file name or empty string
+func archiveFormat(name string) string {
+	for _, format := range ArchiveFormats {
+		if strings.HasSuffix(name, "."+format) {
+			return format
+		}
+	}
+	return ""
+}
+
+// newArchiveWriter create writer of archive format. Zero level means default compression
+func newArchiveWriter(format string, level int, w io.Writer) (archiveWriter, error) {
+	switch format {
+	case FormatTarGz:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		gzipWriter, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error create gzip writer with level %d", level)
+		}
+		return &tarArchiveWriter{tarWriter: tar.NewWriter(gzipWriter), compressor: gzipWriter}, nil
+	case FormatTarZst:
+		var options []zstd.EOption
+		if level != 0 {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		zstdWriter, err := zstd.NewWriter(w, options...)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error create zstd writer")
+		}
+		return &tarArchiveWriter{tarWriter: tar.NewWriter(zstdWriter), compressor: zstdWriter}, nil
+	case FormatTarXz:
+		config := xz.WriterConfig{}
+		if level > 0 && level < len(xzDictCaps) {
+			config.DictCap = xzDictCaps[level]
+		}
+		xzWriter, err := config.NewWriter(w)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error create xz writer")
+		}
+		return &tarArchiveWriter{tarWriter: tar.NewWriter(xzWriter), compressor: xzWriter}, nil
+	case FormatZip:
+		zipWriter := zip.NewWriter(w)
+		if level != 0 {
+			if _, err := flate.NewWriter(nil, level); err != nil {
+				return nil, errors.Wrapf(err, "Error create deflate writer with level %d", level)
+			}
+			zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+				return flate.NewWriter(out, level)
+			})
+		}
+		return &zipArchiveWriter{zipWriter: zipWriter}, nil
+	}
+	return nil, errors.Errorf("unknown archive format %s, expected one of %s", format, strings.Join(ArchiveFormats, ", "))
+}
+
+type tarArchiveWriter struct {
+	tarWriter  *tar.Writer
+	compressor io.WriteCloser
+}
+
+func (w *tarArchiveWriter) WriteMember(member archiveMember, r io.Reader) error {
+	err := w.tarWriter.WriteHeader(&tar.Header{
+		Name:    member.Name,
+		Size:    member.Size,
+		Mode:    int64(member.Mode.Perm()),
+		ModTime: member.ModTime,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not write header for file %s", member.Name)
+	}
+	_, err = io.Copy(w.tarWriter, io.LimitReader(r, member.Size))
+	return err
+}
+
+func (w *tarArchiveWriter) Close() error {
+	err := w.tarWriter.Close()
+	if err != nil {
+		return errors.Wrap(err, "Error tar writer close")
+	}
+	err = w.compressor.Close()
+	if err != nil {
+		return errors.Wrap(err, "Error compressor close")
+	}
+	return nil
+}
+
+type zipArchiveWriter struct {
+	zipWriter *zip.Writer
+}
+
+func (w *zipArchiveWriter) WriteMember(member archiveMember, r io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     member.Name,
+		Method:   zip.Deflate,
+		Modified: member.ModTime,
+	}
+	header.SetMode(member.Mode.Perm())
+	writer, err := w.zipWriter.CreateHeader(header)
+	if err != nil {
+		return errors.Wrapf(err, "could not write header for file %s", member.Name)
+	}
+	_, err = io.Copy(writer, io.LimitReader(r, member.Size))
+	return err
+}
+
+func (w *zipArchiveWriter) Close() error {
+	return w.zipWriter.Close()
+}
+
+// readArchive call fn for every member of archive. Errors of archive decoding are archiveReadError
+func readArchive(filePath, format string, fn func(archiveMember, io.Reader) error) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if format == FormatZip {
+		return readZip(file, fn)
+	}
+	var decompressor io.Reader
+	switch format {
+	case FormatTarGz:
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return archiveReadError{err}
+		}
+		defer gzipReader.Close()
+		decompressor = gzipReader
+	case FormatTarZst:
+		zstdReader, err := zstd.NewReader(file)
+		if err != nil {
+			return archiveReadError{err}
+		}
+		defer zstdReader.Close()
+		decompressor = zstdReader
+	case FormatTarXz:
+		xzReader, err := xz.NewReader(file)
+		if err != nil {
+			return archiveReadError{err}
+		}
+		decompressor = xzReader
+	default:
+		return errors.Errorf("unknown archive format of %s", filePath)
+	}
+	tarReader := tar.NewReader(decompressor)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return archiveReadError{err}
+		}
+		err = fn(archiveMember{Name: header.Name, Size: header.Size, Mode: os.FileMode(header.Mode), ModTime: header.ModTime}, readerWithError{tarReader})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readZip(file *os.File, fn func(archiveMember, io.Reader) error) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	zipReader, err := zip.NewReader(file, stat.Size())
+	if err != nil {
+		return archiveReadError{err}
+	}
+	for _, zipFile := range zipReader.File {
+		reader, err := zipFile.Open()
+		if err != nil {
+			return archiveReadError{err}
+		}
+		member := archiveMember{Name: zipFile.Name, Size: int64(zipFile.UncompressedSize64), Mode: zipFile.Mode(), ModTime: zipFile.Modified}
+		err = fn(member, readerWithError{reader})
+		_ = reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readerWithError mark errors of member content reading as archiveReadError
+type readerWithError struct {
+	io.Reader
+}
+
+func (r readerWithError) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = archiveReadError{err}
+	}
+	return n, err
+}
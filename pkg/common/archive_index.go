@@ -0,0 +1,205 @@
+package common
+
+import (
+	"crypto/sha256"
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/log"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IndexSuffix is added to archive name to get name of its index
+const IndexSuffix = ".index.json"
+
+// ArchiveIndex lists dumps stored in archive. It is saved next to archive
+type ArchiveIndex struct {
+	Archive string        `json:"archive"`
+	Format  string        `json:"format"`
+	Created time.Time     `json:"created"`
+	Members []IndexMember `json:"members"`
+}
+
+// IndexMember describes dump stored in archive
+type IndexMember struct {
+	Name    string    `json:"name"`
+	App     string    `json:"app"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+}
+
+// memberApp return application of archive member by its path in backup directory
+func memberApp(rootDir, name string) string {
+	if filepath.IsAbs(name) {
+		if relPath, err := filepath.Rel(rootDir, name); err == nil {
+			name = filepath.ToSlash(relPath)
+		}
+	}
+	parts := strings.SplitN(strings.TrimPrefix(name, "/"), "/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[0]
+}
+
+// AppAlias return application name used by dump viewer. Applications are renamed by configured aliases
+func AppAlias(app string) string {
+	if alias, ok := root.GetConfig().AliasesMap[app]; ok {
+		return alias
+	}
+	return app
+}
+
+// ListArchives return archives in root of backup directory sorted by name
+func ListArchives(rootDir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(rootDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error read directory %s", rootDir)
+	}
+	var archives []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if _, ok := ParseArchiveName(entry.Name()); ok {
+			archives = append(archives, filepath.Join(rootDir, entry.Name()))
+		}
+	}
+	sort.Strings(archives)
+	return archives, nil
+}
+
+// ReadArchiveIndex return index of archive. Missing or outdated index is rebuilt from archive content and saved
+func ReadArchiveIndex(rootDir, archivePath string) (*ArchiveIndex, error) {
+	archiveInfo, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error stat archive %s", archivePath)
+	}
+	indexPath := archivePath + IndexSuffix
+	if indexInfo, err := os.Stat(indexPath); err == nil && !indexInfo.ModTime().Before(archiveInfo.ModTime()) {
+		content, err := ioutil.ReadFile(indexPath)
+		if err == nil {
+			index := &ArchiveIndex{}
+			if err = json.Unmarshal(content, index); err == nil {
+				return index, nil
+			}
+		}
+		log.Error(fmt.Sprintf("%s. Error read index %s, rebuilding it", err.Error(), indexPath))
+	}
+	index, err := buildArchiveIndex(rootDir, archivePath)
+	if err != nil {
+		return nil, err
+	}
+	err = writeArchiveIndex(archivePath, index)
+	if err != nil {
+		log.Error(err.Error())
+	}
+	return index, nil
+}
+
+// buildArchiveIndex read all members of archive
+func buildArchiveIndex(rootDir, archivePath string) (*ArchiveIndex, error) {
+	format := archiveFormat(archivePath)
+	index := &ArchiveIndex{Archive: filepath.Base(archivePath), Format: format, Created: time.Now()}
+	err := readArchive(archivePath, format, func(member archiveMember, reader io.Reader) error {
+		hash := sha256.New()
+		size, err := io.Copy(hash, reader)
+		if err != nil {
+			return err
+		}
+		index.Members = append(index.Members, IndexMember{
+			Name:    member.Name,
+			App:     memberApp(rootDir, member.Name),
+			Size:    size,
+			ModTime: member.ModTime,
+			SHA256:  hex.EncodeToString(hash.Sum(nil)),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error read archive %s", archivePath)
+	}
+	return index, nil
+}
+
+// writeArchiveIndex save index next to archive
+func writeArchiveIndex(archivePath string, index *ArchiveIndex) error {
+	content, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Error marshal index of %s", archivePath)
+	}
+	indexPath := archivePath + IndexSuffix
+	tmpPath := filepath.Join(filepath.Dir(indexPath), "."+filepath.Base(indexPath)+".tmp")
+	err = ioutil.WriteFile(tmpPath, content, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Error write index %s", tmpPath)
+	}
+	err = os.Rename(tmpPath, indexPath)
+	if err != nil {
+		removeTemp(tmpPath)
+		return errors.Wrapf(err, "Error rename %s to %s", tmpPath, indexPath)
+	}
+	return nil
+}
+
+// ExtractMembers write members of archive with given names to destination directory. Return paths of written files
+func ExtractMembers(archivePath string, names map[string]bool, destDir string) ([]string, error) {
+	var extracted []string
+	err := readArchive(archivePath, archiveFormat(archivePath), func(member archiveMember, reader io.Reader) error {
+		if !names[member.Name] {
+			return nil
+		}
+		relPath := path.Clean("/" + filepath.ToSlash(member.Name))
+		filePath := filepath.Join(destDir, filepath.FromSlash(relPath))
+		err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+		if err != nil {
+			return errors.Wrapf(err, "Error create dir %s", filepath.Dir(filePath))
+		}
+		mode := member.Mode.Perm()
+		if mode == 0 {
+			mode = 0644
+		}
+		file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+		if err != nil {
+			return errors.Wrapf(err, "Error create file %s", filePath)
+		}
+		_, err = io.Copy(file, reader)
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Error extract %s to %s", member.Name, filePath)
+		}
+		err = os.Chtimes(filePath, member.ModTime, member.ModTime)
+		if err != nil {
+			log.Debug(err.Error())
+		}
+		extracted = append(extracted, filePath)
+		return nil
+	})
+	if err != nil {
+		return extracted, errors.Wrapf(err, "Error extract from archive %s", archivePath)
+	}
+	return extracted, nil
+}
+
+// ReadMembers call fn with content of archive members with given names
+func ReadMembers(archivePath string, names map[string]bool, fn func(name string, content io.Reader) error) error {
+	return readArchive(archivePath, archiveFormat(archivePath), func(member archiveMember, reader io.Reader) error {
+		if !names[member.Name] {
+			return nil
+		}
+		return fn(member.Name, reader)
+	})
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestArchive(t *testing.T, archivePath string, names []string) {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(name)), ModTime: time.Now()}
+		if err = tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tarWriter.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, closer := range []interface{ Close() error }{tarWriter, gzipWriter, file} {
+		if err = closer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExtractMembers(t *testing.T) {
+	tests := []struct {
+		name     string
+		member   string
+		expected string
+	}{
+		{"relative path", "app/dump.txt", "app/dump.txt"},
+		{"parent directory", "../../evil.txt", "evil.txt"},
+		{"parent directory inside path", "app/../../other/evil.txt", "other/evil.txt"},
+		{"absolute path", "/etc/evil.txt", "etc/evil.txt"},
+		{"current directory", "./app/./nested/dump.txt", "app/nested/dump.txt"},
+	}
+	tmpDir, err := ioutil.TempDir("", "extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	archivePath := filepath.Join(tmpDir, "dumps.tar.gz")
+	names := map[string]bool{}
+	members := []string{"app/skipped.txt"}
+	for _, test := range tests {
+		names[test.member] = true
+		members = append(members, test.member)
+	}
+	writeTestArchive(t, archivePath, members)
+
+	destDir := filepath.Join(tmpDir, "dest", "nested")
+	extracted, err := ExtractMembers(archivePath, names, destDir)
+	if err != nil {
+		t.Fatalf("ExtractMembers returned error %v", err)
+	}
+	var expected []string
+	for _, test := range tests {
+		filePath := filepath.Join(destDir, filepath.FromSlash(test.expected))
+		expected = append(expected, filePath)
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			t.Errorf("%s: member %s is not extracted to %s: %v", test.name, test.member, filePath, err)
+			continue
+		}
+		if string(content) != test.member {
+			t.Errorf("%s: %s contains %q, expected %q", test.name, filePath, content, test.member)
+		}
+	}
+	sort.Strings(expected)
+	sort.Strings(extracted)
+	if len(extracted) != len(expected) {
+		t.Fatalf("extracted %v, expected %v", extracted, expected)
+	}
+	for i := range expected {
+		if extracted[i] != expected[i] {
+			t.Errorf("extracted %v, expected %v", extracted, expected)
+			break
+		}
+	}
+	// Nothing is written outside of destination directory
+	err = filepath.Walk(tmpDir, func(fileName string, fileInfo os.FileInfo, err error) error {
+		if err != nil || fileInfo.IsDir() || fileName == archivePath {
+			return err
+		}
+		if rel, err := filepath.Rel(destDir, fileName); err != nil || strings.HasPrefix(rel, "..") {
+			t.Errorf("file %s is written outside of %s", fileName, destDir)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package common
+
+import "github.com/pkg/errors"
+
+// DiskSpace is not supported on this platform
+func DiskSpace(dir string) (uint64, uint64, error) {
+	return 0, 0, errors.Errorf("disk usage of %s is not supported on this platform", dir)
+}
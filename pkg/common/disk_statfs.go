@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package common
+
+import (
+	"github.com/pkg/errors"
+	"syscall"
+)
+
+// DiskSpace return used and total bytes of filesystem containing dir
+func DiskSpace(dir string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, 0, errors.Wrapf(err, "Error statfs %s", dir)
+	}
+	total := uint64(stat.Blocks) * uint64(stat.Bsize)
+	available := uint64(stat.Bavail) * uint64(stat.Bsize)
+	return total - available, total, nil
+}
@@ -86,6 +86,9 @@ func copyFileContents(src, dst string) error {
 	return nil
 }
 
+// bigFileHeadSize is size of beginning of file exceeding maximum size which is sent instead of whole file
+const bigFileHeadSize = 4096
+
 // ReadBigFile ...
 func ReadBigFile(fileName string) ([]byte, error) {
 	fi, err := os.Open(fileName)
@@ -98,10 +101,18 @@ func ReadBigFile(fileName string) ([]byte, error) {
 		}
 	}()
 	r := bufio.NewReader(fi)
-	buf := make([]byte, 4096)
+	buf := make([]byte, bigFileHeadSize)
 	_, err = r.Read(buf)
 	if err != nil && err != io.EOF {
-		return nil, errors.Wrapf(err, "Error read first 4096 bytes from %s", fileName)
+		return nil, errors.Wrapf(err, "Error read first %d bytes from %s", bigFileHeadSize, fileName)
 	}
 	return buf, nil
 }
+
+// TruncateBigFile return beginning of content of file exceeding maximum size, as ReadBigFile reads it
+func TruncateBigFile(content []byte) []byte {
+	if len(content) > bigFileHeadSize {
+		return content[:bigFileHeadSize]
+	}
+	return content
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"container/heap"
+	"dumpbeat/pkg/exporter"
+	"sync"
+	"time"
+)
+
+// PendingFile is file waiting until it is completely written
+type PendingFile struct {
+	Name      string
+	LastEvent time.Time
+	Deadline  time.Time
+	index     int
+}
+
+type pendingHeap []*PendingFile
+
+func (h pendingHeap) Len() int           { return len(h) }
+func (h pendingHeap) Less(i, j int) bool { return h[i].Deadline.Before(h[j].Deadline) }
+func (h pendingHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *pendingHeap) Push(x interface{}) {
+	item := x.(*PendingFile)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *pendingHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// FileScheduler keeps pending files ordered by readiness deadline. Safe for concurrent use
+type FileScheduler struct {
+	items   pendingHeap
+	files   map[string]*PendingFile
+	maxSize int
+	wake    chan struct{}
+	mux     sync.Mutex
+}
+
+// NewFileScheduler create scheduler holding at most maxSize files (0 - unlimited)
+func NewFileScheduler(maxSize int) *FileScheduler {
+	return &FileScheduler{
+		files:   make(map[string]*PendingFile),
+		maxSize: maxSize,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Schedule add file or move deadline of already pending file. Returns false when scheduler is full
+func (s *FileScheduler) Schedule(name string, lastEvent, deadline time.Time) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if item, ok := s.files[name]; ok {
+		item.LastEvent = lastEvent
+		item.Deadline = deadline
+		heap.Fix(&s.items, item.index)
+	} else {
+		if s.maxSize > 0 && len(s.items) >= s.maxSize {
+			return false
+		}
+		item := &PendingFile{Name: name, LastEvent: lastEvent, Deadline: deadline}
+		heap.Push(&s.items, item)
+		s.files[name] = item
+		exporter.PendingFilesGauge.Set(float64(len(s.items)))
+	}
+	s.notify()
+	return true
+}
+
+// Delete file from scheduler
+func (s *FileScheduler) Delete(name string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	item, ok := s.files[name]
+	if !ok {
+		return
+	}
+	heap.Remove(&s.items, item.index)
+	delete(s.files, name)
+	exporter.PendingFilesGauge.Set(float64(len(s.items)))
+	s.notify()
+}
+
+// Len return count of pending files
+func (s *FileScheduler) Len() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.items)
+}
+
+// Next wait until deadline of earliest pending file and return it removed from scheduler.
+// Returns false when stop channel is closed
+func (s *FileScheduler) Next(stop <-chan struct{}) (PendingFile, bool) {
+	for {
+		s.mux.Lock()
+		var timer <-chan time.Time
+		if len(s.items) > 0 {
+			delay := time.Until(s.items[0].Deadline)
+			if delay <= 0 {
+				item := heap.Pop(&s.items).(*PendingFile)
+				delete(s.files, item.Name)
+				exporter.PendingFilesGauge.Set(float64(len(s.items)))
+				s.mux.Unlock()
+				return *item, true
+			}
+			timer = time.After(delay)
+		}
+		s.mux.Unlock()
+		select {
+		case <-timer:
+		case <-s.wake:
+		case <-stop:
+			return PendingFile{}, false
+		}
+	}
+}
+
+// notify wake up waiting Next because earliest deadline could change. Must be called under lock
+func (s *FileScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,93 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFileSchedulerOrder(t *testing.T) {
+	s := NewFileScheduler(0)
+	now := time.Now()
+	s.Schedule("c", now, now.Add(-1*time.Second))
+	s.Schedule("a", now, now.Add(-3*time.Second))
+	s.Schedule("b", now, now.Add(-2*time.Second))
+	s.Schedule("d", now, now.Add(-4*time.Second))
+	// New event moves deadline of pending file instead of adding it again
+	s.Schedule("d", now, now)
+	s.Delete("b")
+	if s.Len() != 3 {
+		t.Fatalf("Len() = %d, expected 3", s.Len())
+	}
+	for _, expected := range []string{"a", "c", "d"} {
+		file, ok := s.Next(nil)
+		if !ok || file.Name != expected {
+			t.Errorf("Next() = %s %v, expected %s", file.Name, ok, expected)
+		}
+	}
+	if s.Len() != 0 {
+		t.Errorf("Len() = %d after all files returned, expected 0", s.Len())
+	}
+}
+
+func TestFileSchedulerLimit(t *testing.T) {
+	s := NewFileScheduler(2)
+	now := time.Now()
+	tests := []struct {
+		name      string
+		scheduled bool
+	}{
+		{"a", true},
+		{"b", true},
+		{"c", false},
+		// Already pending file is rescheduled when scheduler is full
+		{"a", true},
+	}
+	for _, test := range tests {
+		if scheduled := s.Schedule(test.name, now, now); scheduled != test.scheduled {
+			t.Errorf("Schedule(%s) = %v, expected %v", test.name, scheduled, test.scheduled)
+		}
+	}
+	s.Delete("b")
+	if !s.Schedule("c", now, now) {
+		t.Error("Schedule(c) = false after file was deleted, expected true")
+	}
+}
+
+func TestFileSchedulerWakeup(t *testing.T) {
+	s := NewFileScheduler(0)
+	s.Schedule("late", time.Now(), time.Now().Add(time.Hour))
+	next := make(chan PendingFile)
+	go func() {
+		file, ok := s.Next(nil)
+		if ok {
+			next <- file
+		}
+	}()
+	// Next waits for the late file, earlier deadline must wake it up
+	time.Sleep(50 * time.Millisecond)
+	s.Schedule("early", time.Now(), time.Now().Add(100*time.Millisecond))
+	select {
+	case file := <-next:
+		if file.Name != "early" {
+			t.Errorf("Next() = %s, expected early", file.Name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Next is not woken up by earlier deadline")
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan bool)
+	go func() {
+		_, ok := s.Next(stop)
+		stopped <- ok
+	}()
+	close(stop)
+	select {
+	case ok := <-stopped:
+		if ok {
+			t.Error("Next() returned file after stop, expected false")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Next is not stopped")
+	}
+}
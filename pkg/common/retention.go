@@ -0,0 +1,205 @@
+package common
+
+import (
+	"dumpbeat/pkg/exporter"
+	"dumpbeat/pkg/log"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	kindArchive = "archive"
+	kindBackup  = "backup"
+)
+
+// RetentionRule limits stored files by age in days, total size in megabytes and count. Zero disables limit
+type RetentionRule struct {
+	MaxAge   int
+	MaxSize  int
+	MaxCount int
+}
+
+// RetentionPolicy of backup directory. When disk usage of backup filesystem reaches high watermark
+// oldest archives and backups are deleted until usage falls below low watermark. MinArchives newest
+// archives are never deleted by watermark
+type RetentionPolicy struct {
+	Archives          RetentionRule
+	Backups           RetentionRule
+	PatternFileFilter string
+	HighWatermark     float64
+	LowWatermark      float64
+	MinArchives       int
+}
+
+// maxIdleDeletes is count of deletions in a row which didn't lower disk usage to stop watermark deletion
+const maxIdleDeletes = 10
+
+type storedFile struct {
+	path string
+	kind string
+	size int64
+	date time.Time
+}
+
+// ApplyRetention delete archives and unarchived backups exceeding retention policy
+func ApplyRetention(rootDir string, policy RetentionPolicy) error {
+	if _, err := os.Stat(rootDir); os.IsNotExist(err) {
+		return nil
+	}
+	archives, backups, err := listStoredFiles(rootDir, policy.PatternFileFilter)
+	if err != nil {
+		return err
+	}
+	archives = applyRule(archives, policy.Archives)
+	backups = applyRule(backups, policy.Backups)
+	if policy.HighWatermark <= 0 {
+		return nil
+	}
+	used, total, err := DiskSpace(rootDir)
+	if err != nil {
+		return err
+	}
+	usage := percent(used, total)
+	exporter.BackupDiskUsageGauge.Set(usage)
+	if usage < policy.HighWatermark {
+		return nil
+	}
+	lowWatermark := policy.LowWatermark
+	if lowWatermark <= 0 || lowWatermark > policy.HighWatermark {
+		lowWatermark = policy.HighWatermark
+	}
+	if policy.MinArchives > 0 && len(archives) > policy.MinArchives {
+		archives = archives[:len(archives)-policy.MinArchives]
+	} else if policy.MinArchives > 0 {
+		archives = nil
+	}
+	files := append(archives, backups...)
+	sortByDate(files)
+	var owned int64
+	for _, file := range files {
+		owned += file.size
+	}
+	needed := int64(used) - int64(lowWatermark/100*float64(total))
+	if owned < needed {
+		// Disk is filled by other data, deleting own files can't help
+		log.Error(fmt.Sprintf("Disk usage of %s %.1f%% reached high watermark %.1f%%, but deleting archives and backups (%d bytes) "+
+			"can't free %d bytes to reach low watermark %.1f%%. Files are kept", rootDir, usage, policy.HighWatermark, owned, needed, lowWatermark))
+		return nil
+	}
+	log.Info(fmt.Sprintf("Disk usage of %s %.1f%% reached high watermark %.1f%%, deleting oldest files", rootDir, usage, policy.HighWatermark))
+	idleDeletes := 0
+	for _, file := range files {
+		if usage < lowWatermark {
+			break
+		}
+		deleteStoredFile(file, "watermark")
+		used, total, err = DiskSpace(rootDir)
+		if err != nil {
+			return err
+		}
+		newUsage := percent(used, total)
+		exporter.BackupDiskUsageGauge.Set(newUsage)
+		if newUsage < usage {
+			idleDeletes = 0
+		} else if idleDeletes++; idleDeletes >= maxIdleDeletes {
+			log.Error(fmt.Sprintf("Disk usage of %s didn't decrease after deleting %d files, stop deleting", rootDir, idleDeletes))
+			return nil
+		}
+		usage = newUsage
+	}
+	if usage >= lowWatermark {
+		log.Error(fmt.Sprintf("Disk usage of %s %.1f%% is above low watermark %.1f%% after deleting oldest archives and backups", rootDir, usage, lowWatermark))
+	}
+	return nil
+}
+
+func percent(used, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(used) / float64(total)
+}
+
+// listStoredFiles return archives in root of backup directory and dumps moved to backup directory
+func listStoredFiles(rootDir, patternFileFilter string) ([]storedFile, []storedFile, error) {
+	var archives, backups []storedFile
+	err := filepath.Walk(rootDir, func(fileName string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			log.Error(err.Error())
+			return nil
+		}
+		if fileInfo.IsDir() {
+			return nil
+		}
+		if filepath.Dir(fileName) == filepath.Clean(rootDir) {
+			if date, ok := ParseArchiveName(fileInfo.Name()); ok {
+				archives = append(archives, storedFile{path: fileName, kind: kindArchive, size: fileInfo.Size(), date: date})
+				return nil
+			}
+		}
+		matched, err := filepath.Match(patternFileFilter, fileInfo.Name())
+		if err != nil {
+			return err
+		}
+		if matched {
+			backups = append(backups, storedFile{path: fileName, kind: kindBackup, size: fileInfo.Size(), date: fileInfo.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return archives, backups, nil
+}
+
+// applyRule delete files exceeding rule oldest first and return kept files
+func applyRule(files []storedFile, rule RetentionRule) []storedFile {
+	sortByDate(files)
+	var kept []storedFile
+	var totalSize int64
+	for _, file := range files {
+		if rule.MaxAge > 0 && int(time.Since(GetStartDay(file.date)).Hours())/24 > rule.MaxAge {
+			deleteStoredFile(file, "age")
+			continue
+		}
+		kept = append(kept, file)
+		totalSize += file.size
+	}
+	for len(kept) > 0 && rule.MaxCount > 0 && len(kept) > rule.MaxCount {
+		totalSize -= kept[0].size
+		deleteStoredFile(kept[0], "count")
+		kept = kept[1:]
+	}
+	for len(kept) > 0 && rule.MaxSize > 0 && totalSize > int64(rule.MaxSize)*1048576 {
+		totalSize -= kept[0].size
+		deleteStoredFile(kept[0], "size")
+		kept = kept[1:]
+	}
+	return kept
+}
+
+func sortByDate(files []storedFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].date.Before(files[j].date)
+	})
+}
+
+func deleteStoredFile(file storedFile, reason string) {
+	err := os.Remove(file.path)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s: Error remove %s by retention policy", err.Error(), file.path))
+		return
+	}
+	if file.kind == kindArchive {
+		err = os.Remove(file.path + IndexSuffix)
+		if err != nil && !os.IsNotExist(err) {
+			log.Error(fmt.Sprintf("%s: Error remove index of %s", err.Error(), file.path))
+		}
+	}
+	log.Info(fmt.Sprintf("Removed %s %s by retention policy (%s), reclaimed %d bytes", file.kind, file.path, reason, file.size))
+	exporter.RetentionReclaimedBytesCounter.WithLabelValues(file.kind, reason).Add(float64(file.size))
+	exporter.RetentionDeletedFilesCounter.WithLabelValues(file.kind, reason).Inc()
+}
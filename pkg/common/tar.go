@@ -1,19 +1,42 @@
 package common
 
 import (
-	"archive/tar"
-	"compress/gzip"
+	"crypto/sha256"
+	"dumpbeat/pkg/exporter"
 	"dumpbeat/pkg/log"
+	"encoding/hex"
 	"fmt"
 	"github.com/pkg/errors"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
-func ArchiveDumps(rootDir, patternFileFilter string, daysToArchive int) error {
+const (
+	// GroupByDay put dumps of one day to archive 2006-01-02.tar.gz
+	GroupByDay = "day"
+	// GroupByAppDay put dumps of one application and day to archive 2006-01-02_app.tar.gz
+	GroupByAppDay = "app_day"
+	// GroupByWeek put dumps of ISO week to archive 2006-W01.tar.gz
+	GroupByWeek = "week"
+	// MemberNamesRelative store dumps in archive with paths relative to backup directory
+	MemberNamesRelative = "relative"
+	// MemberNamesAbsolute store dumps in archive with absolute paths
+	MemberNamesAbsolute = "absolute"
+)
+
+// ArchiveOptions describe format, compression level, member names and grouping of archives
+type ArchiveOptions struct {
+	Format      string
+	Level       int
+	MemberNames string
+	Grouping    string
+}
+
+func ArchiveDumps(rootDir, patternFileFilter string, daysToArchive int, options ArchiveOptions) error {
 	if _, err := os.Stat(rootDir); os.IsNotExist(err) {
 		err := os.MkdirAll(rootDir, os.ModePerm)
 		if err != nil {
@@ -21,20 +44,33 @@ func ArchiveDumps(rootDir, patternFileFilter string, daysToArchive int) error {
 			return err
 		}
 	}
-	groupFiles, err := createFileListForArchive(rootDir, patternFileFilter, daysToArchive)
+	if options.Format == "" {
+		options.Format = FormatTarGz
+	}
+	if archiveFormat("."+options.Format) != options.Format {
+		return errors.Errorf("unknown archive format %s, expected one of %s", options.Format, strings.Join(ArchiveFormats, ", "))
+	}
+	groupFiles, err := createFileListForArchive(rootDir, patternFileFilter, daysToArchive, options.Grouping)
 	if err != nil {
 		return err
 	}
-	for day := range groupFiles {
-		err := createTarball(path.Join(rootDir, fmt.Sprintf("%s.tar.gz", day)), groupFiles[day])
+	failed := 0
+	var lastErr error
+	for group := range groupFiles {
+		err := createArchive(filepath.Join(rootDir, fmt.Sprintf("%s.%s", group, options.Format)), rootDir, groupFiles[group], options)
 		if err != nil {
 			log.Error(err.Error())
+			failed++
+			lastErr = err
 		}
 	}
+	if lastErr != nil {
+		return errors.Wrapf(lastErr, "Error create %d of %d archives", failed, len(groupFiles))
+	}
 	return nil
 }
 
-func createFileListForArchive(rootDir string, patternFileFilter string, daysToArchive int) (map[string][]string, error) {
+func createFileListForArchive(rootDir string, patternFileFilter string, daysToArchive int, grouping string) (map[string][]string, error) {
 	groupFiles := make(map[string][]string)
 	err := filepath.Walk(rootDir, func(fileName string, fileInfo os.FileInfo, err error) error {
 		if err != nil {
@@ -51,8 +87,8 @@ func createFileListForArchive(rootDir string, patternFileFilter string, daysToAr
 		}
 		if matched {
 			if int(time.Since(GetStartDay(fileInfo.ModTime())).Hours())/24 > daysToArchive {
-				formattedDate := fileInfo.ModTime().Format("2006-01-02")
-				groupFiles[formattedDate] = append(groupFiles[formattedDate], fileName)
+				group := archiveGroup(rootDir, fileName, fileInfo.ModTime(), grouping)
+				groupFiles[group] = append(groupFiles[group], fileName)
 			}
 		}
 		return nil
@@ -64,51 +100,243 @@ func createFileListForArchive(rootDir string, patternFileFilter string, daysToAr
 	return groupFiles, nil
 }
 
-func createTarball(tarballFilePath string, filePaths []string) error {
-	file, err := os.Create(tarballFilePath)
+// archiveGroup return archive name without extension for dump file
+func archiveGroup(rootDir, fileName string, modTime time.Time, grouping string) string {
+	switch grouping {
+	case GroupByWeek:
+		year, week := modTime.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case GroupByAppDay:
+		relPath, err := filepath.Rel(rootDir, fileName)
+		if err == nil {
+			if parts := strings.SplitN(filepath.ToSlash(relPath), "/", 2); len(parts) == 2 {
+				return fmt.Sprintf("%s_%s", modTime.Format("2006-01-02"), parts[0])
+			}
+		}
+	}
+	return modTime.Format("2006-01-02")
+}
+
+// ParseArchiveName return first day of dumps stored in archive by its name
+func ParseArchiveName(name string) (time.Time, bool) {
+	format := archiveFormat(name)
+	if format == "" {
+		return time.Time{}, false
+	}
+	group := strings.TrimSuffix(name, "."+format)
+	if i := strings.Index(group, "_"); i >= 0 {
+		group = group[:i]
+	}
+	if date, err := time.ParseInLocation("2006-01-02", group, time.Local); err == nil {
+		return date, true
+	}
+	var year, week int
+	if n, err := fmt.Sscanf(group, "%d-W%d", &year, &week); err == nil && n == 2 && fmt.Sprintf("%d-W%02d", year, week) == group {
+		// Monday of ISO week: week 1 contains January 4
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.Local)
+		monday := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+		return monday.AddDate(0, 0, (week-1)*7), true
+	}
+	return time.Time{}, false
+}
+
+// memberName return name of dump file in archive
+func memberName(rootDir, filePath, memberNames string) string {
+	if memberNames == MemberNamesAbsolute {
+		return filePath
+	}
+	relPath, err := filepath.Rel(rootDir, filePath)
 	if err != nil {
-		return errors.Wrapf(err, "could not create tarball file %s", tarballFilePath)
+		return filePath
 	}
-	defer func() {
-		err := file.Close()
-		if err != nil {
-			log.Error(fmt.Sprintf("%s: Error file close. %s", file.Name(), err.Error()))
-		}
-	}()
+	return filepath.ToSlash(relPath)
+}
 
-	gzipWriter := gzip.NewWriter(file)
-	defer func() {
-		err := gzipWriter.Close()
+// createArchive add files to archive. Members of existing archive are copied to temporary file together with
+// new files, written archive is verified and atomically replaces old one. Source files are removed only after that
+func createArchive(archiveFilePath, rootDir string, filePaths []string, options ArchiveOptions) error {
+	tmpFilePath := filepath.Join(filepath.Dir(archiveFilePath), "."+filepath.Base(archiveFilePath)+".tmp")
+	checksums, err := writeArchive(tmpFilePath, archiveFilePath, rootDir, filePaths, options)
+	if err != nil {
+		removeTemp(tmpFilePath)
+		return err
+	}
+	members, err := verifyArchive(tmpFilePath, options.Format, rootDir, checksums)
+	if err != nil {
+		removeTemp(tmpFilePath)
+		return errors.Wrapf(err, "Error verify archive %s, source files are kept", archiveFilePath)
+	}
+	err = os.Rename(tmpFilePath, archiveFilePath)
+	if err != nil {
+		removeTemp(tmpFilePath)
+		return errors.Wrapf(err, "Error rename %s to %s", tmpFilePath, archiveFilePath)
+	}
+	syncDir(filepath.Dir(archiveFilePath))
+	index := &ArchiveIndex{Archive: filepath.Base(archiveFilePath), Format: options.Format, Created: time.Now(), Members: members}
+	err = writeArchiveIndex(archiveFilePath, index)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Index will be rebuilt on search", err.Error()))
+	}
+	for _, filePath := range filePaths {
+		if relPath, err := filepath.Rel(rootDir, filePath); err == nil {
+			exporter.DumpsArchivedCounter.WithLabelValues(AppAlias(memberApp(rootDir, filepath.ToSlash(relPath)))).Inc()
+		}
+		err = os.Remove(filePath)
 		if err != nil {
-			log.Error(fmt.Sprintf("%s: Error gzip writer close. %s", file.Name(), err.Error()))
+			return errors.Wrapf(err, "Error remove %s after add file to archive", filePath)
 		}
-	}()
+	}
+	return nil
+}
 
-	tarWriter := tar.NewWriter(gzipWriter)
+// writeArchive write members of existing archive and files to new archive. Return checksums of written members
+func writeArchive(tmpFilePath, archiveFilePath, rootDir string, filePaths []string, options ArchiveOptions) (map[string]string, error) {
+	file, err := os.Create(tmpFilePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create archive file %s", tmpFilePath)
+	}
 	defer func() {
-		err := tarWriter.Close()
+		err := file.Close()
 		if err != nil {
-			log.Error(fmt.Sprintf("%s: Error tar writer close. %s", file.Name(), err.Error()))
+			log.Debug(fmt.Sprintf("%s: Error file close. %s", file.Name(), err.Error()))
 		}
 	}()
+	writer, err := newArchiveWriter(options.Format, options.Level, file)
+	if err != nil {
+		return nil, err
+	}
 
+	checksums := make(map[string]string)
+	err = copyArchive(archiveFilePath, options.Format, writer, checksums)
+	if err != nil {
+		return nil, err
+	}
 	for _, filePath := range filePaths {
-		err := addFileToTarWriter(filePath, tarWriter)
+		name := uniqueMemberName(memberName(rootDir, filePath, options.MemberNames), checksums)
+		checksum, err := addFileToArchive(filePath, name, writer)
 		if err != nil {
-			return errors.Wrapf(err, "could not add file %s, to tarball", filePath)
+			return nil, errors.Wrapf(err, "could not add file %s, to archive", filePath)
 		}
-		err = os.Remove(filePath)
+		checksums[name] = checksum
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error close archive %s", tmpFilePath)
+	}
+	err = file.Sync()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error sync %s", tmpFilePath)
+	}
+	return checksums, nil
+}
+
+// uniqueMemberName return name not used in archive yet. Dump archived again under the same path
+// is stored as name.1.ext, name.2.ext, ... so earlier dump is kept
+func uniqueMemberName(name string, used map[string]string) string {
+	if _, ok := used[name]; !ok {
+		return name
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s.%d%s", base, i, ext)
+		if _, ok := used[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+// copyArchive copy all members of existing archive. Checksums of copied members are added for verification.
+// Unreadable archive is kept aside under new name
+func copyArchive(archiveFilePath, format string, writer archiveWriter, checksums map[string]string) error {
+	if _, err := os.Stat(archiveFilePath); os.IsNotExist(err) {
+		return nil
+	}
+	copied := make(map[string]string)
+	err := readArchive(archiveFilePath, format, func(member archiveMember, reader io.Reader) error {
+		hash := sha256.New()
+		err := writer.WriteMember(member, io.TeeReader(reader, hash))
 		if err != nil {
-			return errors.Wrapf(err, "Error remove %s after add file to tar")
+			return errors.Wrapf(err, "could not copy member %s of %s", member.Name, archiveFilePath)
+		}
+		copied[member.Name] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		if _, ok := errors.Cause(err).(archiveReadError); !ok {
+			return err
 		}
+		corruptFilePath := fmt.Sprintf("%s.corrupt-%d", archiveFilePath, time.Now().Unix())
+		log.Error(fmt.Sprintf("%s. Existing archive %s is unreadable, keeping it as %s", err.Error(), archiveFilePath, corruptFilePath))
+		renameErr := os.Rename(archiveFilePath, corruptFilePath)
+		if renameErr != nil {
+			return errors.Wrapf(renameErr, "Error rename unreadable archive %s", archiveFilePath)
+		}
+		return errors.Wrapf(err, "Existing archive %s is unreadable", archiveFilePath)
+	}
+	for name, checksum := range copied {
+		checksums[name] = checksum
 	}
 	return nil
 }
 
-func addFileToTarWriter(filePath string, tarWriter *tar.Writer) error {
+// verifyArchive read written archive and compare checksums of all members. Return members for archive index
+func verifyArchive(archiveFilePath, format, rootDir string, checksums map[string]string) ([]IndexMember, error) {
+	var members []IndexMember
+	found := make(map[string]bool)
+	err := readArchive(archiveFilePath, format, func(member archiveMember, reader io.Reader) error {
+		hash := sha256.New()
+		size, err := io.Copy(hash, reader)
+		if err != nil {
+			return err
+		}
+		checksum := hex.EncodeToString(hash.Sum(nil))
+		if expected, ok := checksums[member.Name]; ok && expected != checksum {
+			return errors.Errorf("checksum mismatch of member %s", member.Name)
+		}
+		found[member.Name] = true
+		members = append(members, IndexMember{
+			Name:    member.Name,
+			App:     memberApp(rootDir, member.Name),
+			Size:    size,
+			ModTime: member.ModTime,
+			SHA256:  checksum,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name := range checksums {
+		if !found[name] {
+			return nil, errors.Errorf("member %s not found", name)
+		}
+	}
+	return members, nil
+}
+
+func removeTemp(filePath string) {
+	err := os.Remove(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Error(fmt.Sprintf("%s: Error remove temporary file. %s", filePath, err.Error()))
+	}
+}
+
+// syncDir flush directory entry after rename. Not supported on some platforms, errors are ignored
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// addFileToArchive add file to archive under name and return its sha256 checksum
+func addFileToArchive(filePath, name string, writer archiveWriter) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return errors.Wrapf(err, "could not open file %s", filePath)
+		return "", errors.Wrapf(err, "could not open file %s", filePath)
 	}
 	defer func() {
 		err := file.Close()
@@ -119,25 +347,20 @@ func addFileToTarWriter(filePath string, tarWriter *tar.Writer) error {
 
 	stat, err := file.Stat()
 	if err != nil {
-		return errors.Wrapf(err, "could not get stat for file %s", filePath)
+		return "", errors.Wrapf(err, "could not get stat for file %s", filePath)
 	}
 
-	header := &tar.Header{
-		Name:    filePath,
+	hash := sha256.New()
+	member := archiveMember{
+		Name:    name,
 		Size:    stat.Size(),
-		Mode:    int64(stat.Mode()),
+		Mode:    stat.Mode(),
 		ModTime: stat.ModTime(),
 	}
-
-	err = tarWriter.WriteHeader(header)
-	if err != nil {
-		return errors.Wrapf(err, "could not write header for file %s", filePath)
-	}
-
-	_, err = io.Copy(tarWriter, file)
+	err = writer.WriteMember(member, io.TeeReader(file, hash))
 	if err != nil {
-		return errors.Wrapf(err, "could not copy the file %s data to the tarball", filePath)
+		return "", errors.Wrapf(err, "could not copy the file %s data to the archive", filePath)
 	}
 
-	return nil
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
@@ -0,0 +1,158 @@
+package common
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeDump create dump file in backup directory with given modification time
+func writeDump(t *testing.T, rootDir, relPath, content string, modTime time.Time) string {
+	filePath := filepath.Join(rootDir, filepath.FromSlash(relPath))
+	err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filePath, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(filePath, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+// readTestArchive return content of all archive members by name
+func readTestArchive(t *testing.T, archivePath, format string) map[string]string {
+	contents := make(map[string]string)
+	err := readArchive(archivePath, format, func(member archiveMember, reader io.Reader) error {
+		content, err := ioutil.ReadAll(reader)
+		contents[member.Name] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Error read archive %s: %v", archivePath, err)
+	}
+	return contents
+}
+
+func TestArchiveDumpsMerge(t *testing.T) {
+	for _, format := range ArchiveFormats {
+		rootDir, err := ioutil.TempDir("", "archive")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(rootDir)
+		modTime := time.Now().AddDate(0, 0, -3)
+		archivePath := filepath.Join(rootDir, modTime.Format("2006-01-02")+"."+format)
+		options := ArchiveOptions{Format: format}
+
+		first := writeDump(t, rootDir, "app/dump.txt", "first", modTime)
+		other := writeDump(t, rootDir, "other/dump.txt", "other", modTime)
+		fresh := writeDump(t, rootDir, "app/fresh.txt", "fresh", time.Now())
+		if err = ArchiveDumps(rootDir, "*.txt", 1, options); err != nil {
+			t.Fatalf("%s: ArchiveDumps returned error %v", format, err)
+		}
+		// Late dumps of the same day, one of them under already archived path
+		second := writeDump(t, rootDir, "app/dump.txt", "second", modTime)
+		late := writeDump(t, rootDir, "app/late.txt", "late", modTime)
+		if err = ArchiveDumps(rootDir, "*.txt", 1, options); err != nil {
+			t.Fatalf("%s: ArchiveDumps of late dumps returned error %v", format, err)
+		}
+		third := writeDump(t, rootDir, "app/dump.txt", "third", modTime)
+		if err = ArchiveDumps(rootDir, "*.txt", 1, options); err != nil {
+			t.Fatalf("%s: ArchiveDumps of third dump returned error %v", format, err)
+		}
+
+		expected := map[string]string{
+			"app/dump.txt":   "first",
+			"other/dump.txt": "other",
+			"app/dump.1.txt": "second",
+			"app/late.txt":   "late",
+			"app/dump.2.txt": "third",
+		}
+		if contents := readTestArchive(t, archivePath, format); !reflect.DeepEqual(contents, expected) {
+			t.Errorf("%s: archive contains %v, expected %v", format, contents, expected)
+		}
+		for _, filePath := range []string{first, other, second, late, third} {
+			if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+				t.Errorf("%s: archived dump %s is not removed", format, filePath)
+			}
+		}
+		if _, err := os.Stat(fresh); err != nil {
+			t.Errorf("%s: dump %s newer than days to archive is removed: %v", format, fresh, err)
+		}
+		index, err := ReadArchiveIndex(rootDir, archivePath)
+		if err != nil {
+			t.Fatalf("%s: Error read index: %v", format, err)
+		}
+		if len(index.Members) != len(expected) {
+			t.Errorf("%s: index has %d members, expected %d", format, len(index.Members), len(expected))
+		}
+	}
+}
+
+func TestArchiveDumpsUnreadableArchive(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+	modTime := time.Now().AddDate(0, 0, -3)
+	archivePath := filepath.Join(rootDir, modTime.Format("2006-01-02")+"."+FormatTarGz)
+	err = ioutil.WriteFile(archivePath, []byte("not an archive"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := writeDump(t, rootDir, "app/dump.txt", "dump", modTime)
+
+	if err = ArchiveDumps(rootDir, "*.txt", 1, ArchiveOptions{Format: FormatTarGz}); err == nil {
+		t.Fatal("ArchiveDumps with unreadable archive expected error")
+	}
+	if _, err := os.Stat(dump); err != nil {
+		t.Errorf("dump %s is removed although archiving failed: %v", dump, err)
+	}
+	corrupt, err := filepath.Glob(archivePath + ".corrupt-*")
+	if err != nil || len(corrupt) != 1 {
+		t.Errorf("unreadable archive is not kept aside: %v %v", corrupt, err)
+	}
+
+	// Next run creates new archive with the dump
+	if err = ArchiveDumps(rootDir, "*.txt", 1, ArchiveOptions{Format: FormatTarGz}); err != nil {
+		t.Fatalf("ArchiveDumps returned error %v", err)
+	}
+	expected := map[string]string{"app/dump.txt": "dump"}
+	if contents := readTestArchive(t, archivePath, FormatTarGz); !reflect.DeepEqual(contents, expected) {
+		t.Errorf("archive contains %v, expected %v", contents, expected)
+	}
+	if _, err := os.Stat(dump); !os.IsNotExist(err) {
+		t.Errorf("archived dump %s is not removed", dump)
+	}
+}
+
+func TestUniqueMemberName(t *testing.T) {
+	used := map[string]string{
+		"app/dump.txt":   "",
+		"app/dump.1.txt": "",
+		"app/core":       "",
+	}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"app/new.txt", "app/new.txt"},
+		{"app/dump.txt", "app/dump.2.txt"},
+		{"app/core", "app/core.1"},
+	}
+	for _, test := range tests {
+		if name := uniqueMemberName(test.name, used); name != test.expected {
+			t.Errorf("uniqueMemberName(%s) = %s, expected %s", test.name, name, test.expected)
+		}
+	}
+}
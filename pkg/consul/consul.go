@@ -1,20 +1,51 @@
 package consul
 
 import (
+	"fmt"
 	consul "github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
+	"net"
+	"strconv"
 )
 
 // Client provides an interface for getting data out of Consul
 type Client interface {
-	// Get a Service from consul
-	Service(string, string) ([]*consul.ServiceEntry, *consul.QueryMeta, error)
-	// Register a service with local agent
-	Register(string, string, int) error
-	// Deregister a service with local agent
+	// Get healthy instances of Service from consul
+	Service(string, string, *consul.QueryOptions) ([]*consul.ServiceEntry, *consul.QueryMeta, error)
+	// Register a service instance with local agent
+	Register(Registration) error
+	// Deregister a service instance with local agent
 	DeRegister(string) error
 	// Catalog ...
 	Catalog() *consul.Catalog
+	// UpdateTTL set status of TTL check
+	UpdateTTL(string, string, string) error
+	// KV list keys with prefix
+	KV(string, *consul.QueryOptions) (consul.KVPairs, *consul.QueryMeta, error)
+}
+
+// Registration describes service instance registered in local agent
+type Registration struct {
+	ID      string
+	Name    string
+	Address string
+	Port    int
+	Tags    []string
+	Meta    map[string]string
+	// DeregisterCriticalAfter is duration after which agent removes instance with critical checks
+	DeregisterCriticalAfter string
+	// CheckInterval is interval of HTTP check of health endpoint
+	CheckInterval string
+}
+
+// UploadCheckID return id of TTL check reflecting dump upload health of service instance
+func UploadCheckID(id string) string {
+	return id + ":upload"
+}
+
+// HealthCheckID return id of HTTP check of exporter health endpoint of service instance
+func HealthCheckID(id string) string {
+	return id + ":health"
 }
 
 type client struct {
@@ -36,31 +67,68 @@ func (c *client) Catalog() *consul.Catalog {
 	return c.consul.Catalog()
 }
 
-// Register a service with consul local agent
-func (c *client) Register(name string, address string, port int) error {
+// Register a service instance with consul local agent. Agent checks health endpoint of exporter and expects
+// refresh of upload TTL check while dumps are processed
+func (c *client) Register(registration Registration) error {
+	checkAddress := registration.Address
+	if checkAddress == "" || checkAddress == "0.0.0.0" {
+		checkAddress = "127.0.0.1"
+	}
 	reg := &consul.AgentServiceRegistration{
-		Address: address,
-		ID:      name,
-		Name:    name,
-		Port:    port,
+		Address: registration.Address,
+		ID:      registration.ID,
+		Name:    registration.Name,
+		Port:    registration.Port,
+		Tags:    registration.Tags,
+		Meta:    registration.Meta,
+		Checks: consul.AgentServiceChecks{
+			{
+				CheckID:                        UploadCheckID(registration.ID),
+				Name:                           "Dump upload",
+				TTL:                            "90s",
+				Status:                         consul.HealthPassing,
+				DeregisterCriticalServiceAfter: registration.DeregisterCriticalAfter,
+			},
+			{
+				CheckID:                        HealthCheckID(registration.ID),
+				Name:                           "Dumpbeat health",
+				HTTP:                           fmt.Sprintf("http://%s/health", net.JoinHostPort(checkAddress, strconv.Itoa(registration.Port))),
+				Interval:                       registration.CheckInterval,
+				Timeout:                        "5s",
+				DeregisterCriticalServiceAfter: registration.DeregisterCriticalAfter,
+			},
+		},
 	}
 	return c.consul.Agent().ServiceRegister(reg)
 }
 
+// UpdateTTL set status (passing|warning|critical) and output of TTL check
+func (c *client) UpdateTTL(checkID, output, status string) error {
+	return c.consul.Agent().UpdateTTL(checkID, output, status)
+}
+
 // DeRegister a service with consul local agent
 func (c *client) DeRegister(id string) error {
 	return c.consul.Agent().ServiceDeregister(id)
 }
 
-// Service return a service
-func (c *client) Service(service, tag string) ([]*consul.ServiceEntry, *consul.QueryMeta, error) {
+// Service return healthy instances of a service. Options with WaitIndex make blocking query
+// which returns when instances change or wait time passes
+func (c *client) Service(service, tag string, options *consul.QueryOptions) ([]*consul.ServiceEntry, *consul.QueryMeta, error) {
 	passingOnly := true
-	addrs, meta, err := c.consul.Health().Service(service, tag, passingOnly, nil)
-	if len(addrs) == 0 && err == nil {
-		return nil, nil, errors.Wrapf(err, "service ( %s ) was not found", service)
-	}
+	addrs, meta, err := c.consul.Health().Service(service, tag, passingOnly, options)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "error get service info from consul")
 	}
 	return addrs, meta, nil
 }
+
+// KV list keys with prefix. Options with WaitIndex make blocking query
+// which returns when keys change or wait time passes
+func (c *client) KV(prefix string, options *consul.QueryOptions) (consul.KVPairs, *consul.QueryMeta, error) {
+	pairs, meta, err := c.consul.KV().List(prefix, options)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error list consul keys %s", prefix)
+	}
+	return pairs, meta, nil
+}
@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/consul"
+	"dumpbeat/pkg/version"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+const (
+	// BackendNone disables registration
+	BackendNone = "none"
+	// BackendConsul registers service in local consul agent
+	BackendConsul = "consul"
+	// BackendFileSD writes prometheus file_sd target file
+	BackendFileSD = "file_sd"
+	// BackendEtcd puts service key with lease to etcd
+	BackendEtcd = "etcd"
+)
+
+// Health statuses of agent
+const (
+	StatusPassing  = "passing"
+	StatusWarning  = "warning"
+	StatusCritical = "critical"
+)
+
+// Registry registers agent in service discovery
+type Registry interface {
+	// Register service with address and port of exporter
+	Register(string, string, int) error
+	// DeRegister service
+	DeRegister(string) error
+	// UpdateHealth set status (passing|warning|critical) and output of service health
+	UpdateHealth(string, string, string) error
+}
+
+// New create registry of configured service discovery backend
+func New(config *root.Config) (Registry, error) {
+	switch config.ServiceDiscovery {
+	case BackendNone:
+		return noneRegistry{}, nil
+	case BackendConsul, "":
+		client, err := consul.NewConsulClient(config.ConsulHost)
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot create consul client")
+		}
+		return &consulRegistry{client: client, config: config}, nil
+	case BackendFileSD:
+		return &fileSDRegistry{path: config.FileSDPath, nodeName: config.NodeName}, nil
+	case BackendEtcd:
+		return newEtcdRegistry(config), nil
+	}
+	return nil, errors.Errorf("unknown service discovery backend %s, expected none, consul, file_sd or etcd", config.ServiceDiscovery)
+}
+
+type noneRegistry struct{}
+
+func (noneRegistry) Register(string, string, int) error        { return nil }
+func (noneRegistry) DeRegister(string) error                   { return nil }
+func (noneRegistry) UpdateHealth(string, string, string) error { return nil }
+
+// consulRegistry registers service instance with TTL and HTTP checks in consul agent
+type consulRegistry struct {
+	client consul.Client
+	config *root.Config
+}
+
+func (r *consulRegistry) Register(name, address string, port int) error {
+	return r.client.Register(consul.Registration{
+		ID:                      InstanceID(r.config),
+		Name:                    name,
+		Address:                 address,
+		Port:                    port,
+		Tags:                    serviceTags(r.config),
+		Meta:                    serviceMeta(r.config),
+		DeregisterCriticalAfter: r.config.ConsulDeregisterCriticalAfter,
+		CheckInterval:           r.config.HealthCheckInterval,
+	})
+}
+
+func (r *consulRegistry) DeRegister(string) error {
+	return r.client.DeRegister(InstanceID(r.config))
+}
+
+func (r *consulRegistry) UpdateHealth(_, status, output string) error {
+	return r.client.UpdateTTL(consul.UploadCheckID(InstanceID(r.config)), output, status)
+}
+
+// InstanceID return id of service instance. Instances on one agent differ by node name and exporter port
+func InstanceID(config *root.Config) string {
+	if config.ConsulServiceID != "" {
+		return config.ConsulServiceID
+	}
+	return fmt.Sprintf("%s-%s-%d", config.ConsulServiceName, config.NodeName, config.ExporterBindPort)
+}
+
+func serviceTags(config *root.Config) []string {
+	var tags []string
+	for _, tag := range strings.Split(config.ConsulServiceTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// serviceMeta return meta of service instance: version, node and watched directories with configured meta
+func serviceMeta(config *root.Config) map[string]string {
+	meta := map[string]string{
+		"version":    version.Version(),
+		"node":       config.NodeName,
+		"dump_dir":   config.DumpDir,
+		"backup_dir": config.BackupDir,
+	}
+	for key, value := range config.ConsulServiceMetaMap {
+		meta[key] = value
+	}
+	return meta
+}
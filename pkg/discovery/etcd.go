@@ -0,0 +1,216 @@
+package discovery
+
+import (
+	"bytes"
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/log"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// etcdRegistry puts service key attached to lease through etcd v3 JSON gateway. Key disappears
+// when agent stops refreshing lease
+type etcdRegistry struct {
+	endpoints  []string
+	prefix     string
+	ttl        int
+	nodeName   string
+	httpClient *http.Client
+
+	mux     sync.Mutex
+	key     string
+	lease   string
+	service etcdService
+	stop    chan struct{}
+}
+
+type etcdService struct {
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+	Port    int       `json:"port"`
+	Node    string    `json:"node"`
+	Status  string    `json:"status"`
+	Output  string    `json:"output,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+func newEtcdRegistry(config *root.Config) *etcdRegistry {
+	var endpoints []string
+	for _, endpoint := range strings.Split(config.EtcdEndpoints, ",") {
+		if endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/"); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	ttl := config.EtcdTTL
+	if ttl <= 0 {
+		ttl = 90
+	}
+	return &etcdRegistry{
+		endpoints:  endpoints,
+		prefix:     strings.TrimRight(config.EtcdPrefix, "/"),
+		ttl:        ttl,
+		nodeName:   config.NodeName,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Register grant lease, put service key and keep lease alive until DeRegister
+func (r *etcdRegistry) Register(name, address string, port int) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.key = fmt.Sprintf("%s/%s/%s", r.prefix, name, r.nodeName)
+	r.service = etcdService{Name: name, Address: address, Port: port, Node: r.nodeName, Status: StatusPassing}
+	err := r.grantAndPut()
+	if err != nil {
+		return err
+	}
+	if r.stop == nil {
+		r.stop = make(chan struct{})
+		go r.keepAlive(r.stop)
+	}
+	return nil
+}
+
+// DeRegister revoke lease, etcd deletes service key with it
+func (r *etcdRegistry) DeRegister(string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+	if r.lease == "" {
+		return nil
+	}
+	err := r.call("/v3/lease/revoke", map[string]string{"ID": r.lease}, nil)
+	r.lease = ""
+	return err
+}
+
+// UpdateHealth put service key with new status
+func (r *etcdRegistry) UpdateHealth(_, status, output string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.lease == "" {
+		return errors.New("service is not registered in etcd")
+	}
+	r.service.Status = status
+	r.service.Output = output
+	return r.put()
+}
+
+// keepAlive refresh lease every third of ttl. Expired lease is granted again with service key
+func (r *etcdRegistry) keepAlive(stop chan struct{}) {
+	ticker := time.NewTicker(time.Duration(r.ttl) * time.Second / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		r.mux.Lock()
+		err := r.refresh()
+		r.mux.Unlock()
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error refresh etcd lease of %s", err.Error(), r.key))
+		}
+	}
+}
+
+func (r *etcdRegistry) refresh() error {
+	if r.lease != "" {
+		var response struct {
+			Result struct {
+				TTL string `json:"TTL"`
+			} `json:"result"`
+		}
+		err := r.call("/v3/lease/keepalive", map[string]string{"ID": r.lease}, &response)
+		if err == nil && response.Result.TTL != "" && response.Result.TTL != "0" {
+			return nil
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error keep alive etcd lease %s", err.Error(), r.lease))
+		}
+	}
+	log.Info(fmt.Sprintf("Etcd lease of %s expired, register again", r.key))
+	return r.grantAndPut()
+}
+
+func (r *etcdRegistry) grantAndPut() error {
+	var response struct {
+		ID string `json:"ID"`
+	}
+	err := r.call("/v3/lease/grant", map[string]int{"TTL": r.ttl}, &response)
+	if err != nil {
+		return errors.Wrap(err, "Error grant etcd lease")
+	}
+	if response.ID == "" {
+		return errors.New("etcd returned empty lease id")
+	}
+	r.lease = response.ID
+	return r.put()
+}
+
+func (r *etcdRegistry) put() error {
+	r.service.Updated = time.Now()
+	value, err := json.Marshal(r.service)
+	if err != nil {
+		return errors.Wrap(err, "Error marshal service")
+	}
+	err = r.call("/v3/kv/put", map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(r.key)),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": r.lease,
+	}, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Error put etcd key %s", r.key)
+	}
+	return nil
+}
+
+// call post request to first available etcd endpoint
+func (r *etcdRegistry) call(path string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	if len(r.endpoints) == 0 {
+		return errors.New("etcd endpoints are not configured")
+	}
+	for _, endpoint := range r.endpoints {
+		err = r.post(endpoint+path, body, response)
+		if err == nil {
+			return nil
+		}
+		log.Debug(fmt.Sprintf("%s. Error call etcd %s", err.Error(), endpoint))
+	}
+	return err
+}
+
+func (r *etcdRegistry) post(url string, body []byte, response interface{}) error {
+	resp, err := r.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("etcd %s answered %s: %s", url, resp.Status, strings.TrimSpace(string(content)))
+	}
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(content, response)
+}
@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// fileSDRegistry writes prometheus file_sd target file with exporter address
+type fileSDRegistry struct {
+	path     string
+	nodeName string
+}
+
+type fileSDTarget struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func (r *fileSDRegistry) Register(name, address string, port int) error {
+	if address == "" {
+		address = r.nodeName
+	}
+	return r.write([]fileSDTarget{{
+		Targets: []string{fmt.Sprintf("%s:%d", address, port)},
+		Labels:  map[string]string{"service": name, "node": r.nodeName},
+	}})
+}
+
+// DeRegister leave empty target list, so prometheus drops target
+func (r *fileSDRegistry) DeRegister(string) error {
+	return r.write([]fileSDTarget{})
+}
+
+// UpdateHealth is not reflected in target file, prometheus scrapes health from metrics
+func (r *fileSDRegistry) UpdateHealth(string, string, string) error {
+	return nil
+}
+
+// write target file atomically, prometheus may read it at any moment
+func (r *fileSDRegistry) write(targets []fileSDTarget) error {
+	content, err := json.MarshalIndent(targets, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error marshal file_sd targets")
+	}
+	err = os.MkdirAll(filepath.Dir(r.path), os.ModePerm)
+	if err != nil {
+		return errors.Wrapf(err, "Error create dir %s", filepath.Dir(r.path))
+	}
+	tmpPath := r.path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, content, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Error write %s", tmpPath)
+	}
+	err = os.Rename(tmpPath, r.path)
+	if err != nil {
+		return errors.Wrapf(err, "Error rename %s to %s", tmpPath, r.path)
+	}
+	return nil
+}
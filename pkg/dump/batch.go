@@ -0,0 +1,254 @@
+package dump
+
+import (
+	"bytes"
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/log"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// BatchFormatJSON send batch as JSON array
+	BatchFormatJSON = "json"
+	// BatchFormatNDJSON send batch as newline delimited JSON
+	BatchFormatNDJSON = "ndjson"
+)
+
+type batchItem struct {
+	dump     Dump
+	fileInfo os.FileInfo
+	backup   bool
+	size     int
+}
+
+type batch struct {
+	apiPath string
+	items   []*batchItem
+	size    int
+	created time.Time
+}
+
+// batchResult is per-item result returned by batch endpoint
+type batchResult struct {
+	Filename string `json:"filename"`
+	Status   int    `json:"status"`
+	Error    string `json:"error"`
+}
+
+// Batcher collects dumps per app and sends them with one API request
+type Batcher struct {
+	batches map[string]*batch
+	pending map[string]*batchItem
+	mux     sync.Mutex
+}
+
+var (
+	batcher     *Batcher
+	batcherOnce sync.Once
+)
+
+func getBatcher() *Batcher {
+	batcherOnce.Do(func() {
+		batcher = &Batcher{
+			batches: make(map[string]*batch),
+			pending: make(map[string]*batchItem),
+		}
+		go batcher.run()
+	})
+	return batcher
+}
+
+// FlushBatches send all collected dumps immediately
+func FlushBatches() {
+	if batcher == nil {
+		return
+	}
+	batcher.flush(true)
+}
+
+// Add dump to batch of its app. Full batch is sent immediately. Dump already in batch is not added
+// again, only its backup flag is raised
+func (b *Batcher) Add(d Dump, fileInfo os.FileInfo, backup bool) {
+	config := root.GetConfig()
+	b.mux.Lock()
+	if item, ok := b.pending[d.Filename]; ok {
+		item.backup = item.backup || backup
+		b.mux.Unlock()
+		return
+	}
+	apiPath := d.batchApiPath()
+	current, ok := b.batches[apiPath]
+	if !ok {
+		current = &batch{apiPath: apiPath, created: time.Now()}
+		b.batches[apiPath] = current
+	}
+	item := &batchItem{dump: d, fileInfo: fileInfo, backup: backup, size: len(d.Content)}
+	current.items = append(current.items, item)
+	current.size += item.size
+	b.pending[d.Filename] = item
+	var full *batch
+	if (config.BatchMaxCount > 0 && len(current.items) >= config.BatchMaxCount) ||
+		(config.BatchMaxBytes > 0 && current.size >= config.BatchMaxBytes) {
+		full = b.take(apiPath)
+	}
+	b.mux.Unlock()
+	if full != nil {
+		b.send(full)
+	}
+}
+
+func (b *Batcher) run() {
+	for {
+		<-time.After(time.Second)
+		b.flush(false)
+	}
+}
+
+// flush send batches older than max wait time or all batches when force is set
+func (b *Batcher) flush(force bool) {
+	maxWait := time.Duration(root.GetConfig().BatchMaxWait) * time.Second
+	b.mux.Lock()
+	var ready []*batch
+	for apiPath, current := range b.batches {
+		if force || time.Since(current.created) >= maxWait {
+			ready = append(ready, b.take(apiPath))
+		}
+	}
+	b.mux.Unlock()
+	for _, current := range ready {
+		b.send(current)
+	}
+}
+
+// take remove batch from collecting. Must be called under lock
+func (b *Batcher) take(apiPath string) *batch {
+	current := b.batches[apiPath]
+	delete(b.batches, apiPath)
+	return current
+}
+
+func (b *Batcher) done(items []*batchItem) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for _, item := range items {
+		delete(b.pending, item.dump.Filename)
+	}
+}
+
+// finish move or remove dump file of sent item. Backup flag is read under lock, because Add raises it
+// for dump found again while batch is sent. Raise missed after this is harmless: next walk finds the dump
+// already sent and moves it to backup
+func (b *Batcher) finish(item *batchItem, err error) {
+	b.mux.Lock()
+	backup := item.backup
+	b.mux.Unlock()
+	_ = finishDump(item.dump, item.fileInfo, backup, err)
+}
+
+func (b *Batcher) send(current *batch) {
+	defer b.done(current.items)
+	body, contentType, err := encodeBatch(current.items)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Error encode batch for %s", err.Error(), current.apiPath))
+		return
+	}
+	log.Debug(fmt.Sprintf("Send batch of %d dumps (%d bytes) to %s", len(current.items), len(body), current.apiPath))
+	app := current.items[0].dump.appName()
+	responseBody, err := deliver(app, current.apiPath, contentType, body, fmt.Sprintf("batch of %d dumps", len(current.items)), "")
+	if err != nil && IsPermanent(err) && len(current.items) > 1 {
+		// Rejection of whole batch (e.g. 413 for too large body) says nothing about single dumps
+		log.Error(fmt.Sprintf("%s. Batch rejected by API, sending %d dumps one by one", err.Error(), len(current.items)))
+		for _, item := range current.items {
+			b.finish(item, item.dump.SendDump())
+		}
+		return
+	}
+	if err != nil {
+		for _, item := range current.items {
+			item.dump.observeResult(err)
+			b.finish(item, err)
+		}
+		return
+	}
+	results := decodeBatchResults(responseBody)
+	for i, item := range current.items {
+		err := itemError(current.apiPath, results, i, item.dump.Filename)
+		item.dump.observeResult(err)
+		b.finish(item, err)
+	}
+}
+
+func encodeBatch(items []*batchItem) ([]byte, string, error) {
+	dumps := make([]Dump, 0, len(items))
+	for _, item := range items {
+		dumps = append(dumps, item.dump)
+	}
+	if root.GetConfig().BatchFormat != BatchFormatNDJSON {
+		body, err := json.Marshal(dumps)
+		return body, "application/json", err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, d := range dumps {
+		if err := encoder.Encode(d); err != nil {
+			return nil, "", err
+		}
+	}
+	return buf.Bytes(), "application/x-ndjson", nil
+}
+
+// decodeBatchResults parse per-item results as JSON array or object with results field.
+// Empty result means whole batch was accepted
+func decodeBatchResults(body []byte) []batchResult {
+	var results []batchResult
+	if err := json.Unmarshal(body, &results); err == nil {
+		return results
+	}
+	var wrapped struct {
+		Results []batchResult `json:"results"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err == nil {
+		return wrapped.Results
+	}
+	return nil
+}
+
+// itemError find result for dump by filename or position in batch
+func itemError(url string, results []batchResult, index int, filename string) error {
+	if len(results) == 0 {
+		return nil
+	}
+	var result *batchResult
+	for i := range results {
+		if results[i].Filename == filename {
+			result = &results[i]
+			break
+		}
+	}
+	if result == nil && index < len(results) && results[index].Filename == "" {
+		result = &results[index]
+	}
+	if result == nil {
+		return &ResponseError{URL: url, Status: "missing item result", Retryable: true}
+	}
+	if result.Status == 0 || isSuccessCode(result.Status) {
+		return nil
+	}
+	return &ResponseError{
+		URL:        url,
+		StatusCode: result.Status,
+		Status:     fmt.Sprintf("%d", result.Status),
+		Body:       result.Error,
+		Retryable:  isRetryableCode(result.Status),
+	}
+}
+
+func (d Dump) batchApiPath() string {
+	apiPath := d.apiPath()
+	return strings.TrimSuffix(apiPath, "/add") + "/" + strings.Trim(root.GetConfig().BatchEndpoint, "/")
+}
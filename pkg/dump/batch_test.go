@@ -0,0 +1,164 @@
+package dump
+
+import (
+	root "dumpbeat/pkg"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchAPI accept batches and keep sizes of received batches. Requests wait for release when it is set
+type batchAPI struct {
+	*httptest.Server
+	sizes    []int
+	paths    []string
+	received chan struct{}
+	release  chan struct{}
+	mux      sync.Mutex
+}
+
+func newBatchAPI(block bool) *batchAPI {
+	api := &batchAPI{received: make(chan struct{}, 100)}
+	if block {
+		api.release = make(chan struct{})
+	}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var dumps []Dump
+		if err := json.NewDecoder(r.Body).Decode(&dumps); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		api.mux.Lock()
+		api.sizes = append(api.sizes, len(dumps))
+		api.paths = append(api.paths, r.URL.Path)
+		api.mux.Unlock()
+		api.received <- struct{}{}
+		if api.release != nil {
+			<-api.release
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	return api
+}
+
+func (api *batchAPI) batches() ([]int, []string) {
+	api.mux.Lock()
+	defer api.mux.Unlock()
+	return append([]int(nil), api.sizes...), append([]string(nil), api.paths...)
+}
+
+// setBatchTestConfig enable batching to test API with batch count limit and long wait
+func setBatchTestConfig(t *testing.T, api *batchAPI, maxCount int) (*root.Config, func()) {
+	config, cleanup := setTestConfig(t, &testAPI{Server: api.Server})
+	config.BatchEnabled = true
+	config.BatchMaxCount = maxCount
+	config.BatchMaxWait = 3600
+	config.BatchFormat = BatchFormatJSON
+	config.BatchEndpoint = "add_batch"
+	root.SetConfig(config)
+	return config, cleanup
+}
+
+// addTestDump write dump of app and pass it to batcher by processFile
+func addTestDump(t *testing.T, config *root.Config, name string, backup bool) string {
+	fileName := filepath.Join(config.DumpDir, "app", name)
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		writeTestFile(t, fileName, name, os.O_TRUNC)
+	}
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = processFile(fileName, fileInfo, backup); err != nil {
+		t.Fatalf("processFile(%s) returned error %v", fileName, err)
+	}
+	return fileName
+}
+
+func TestBatcherMaxCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxCount int
+		dumps    int
+		sizes    []int
+	}{
+		{"full batches sent on add", 2, 5, []int{2, 2, 1}},
+		{"unlimited count sent on flush", 0, 3, []int{3}},
+	}
+	for _, test := range tests {
+		api := newBatchAPI(false)
+		config, cleanup := setBatchTestConfig(t, api, test.maxCount)
+		var files []string
+		for i := 0; i < test.dumps; i++ {
+			files = append(files, addTestDump(t, config, string(rune('a'+i))+".txt", true))
+		}
+		FlushBatches()
+		sizes, paths := api.batches()
+		if len(sizes) != len(test.sizes) {
+			t.Errorf("%s: API received batches %v, expected %v", test.name, sizes, test.sizes)
+		}
+		for i := range sizes {
+			if i < len(test.sizes) && sizes[i] != test.sizes[i] {
+				t.Errorf("%s: batch %d has %d dumps, expected %d", test.name, i, sizes[i], test.sizes[i])
+			}
+			if paths[i] != "/app/add_batch" {
+				t.Errorf("%s: batch %d sent to %s, expected /app/add_batch", test.name, i, paths[i])
+			}
+		}
+		for _, fileName := range files {
+			if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+				t.Errorf("%s: sent dump %s is not moved to backup", test.name, fileName)
+			}
+		}
+		api.Close()
+		cleanup()
+	}
+}
+
+func TestBatcherBackupRaisedWhileSending(t *testing.T) {
+	api := newBatchAPI(true)
+	defer api.Close()
+	config, cleanup := setBatchTestConfig(t, api, 1)
+	defer cleanup()
+	fileName := filepath.Join(config.DumpDir, "app", "dump.txt")
+	writeTestFile(t, fileName, "dump", os.O_TRUNC)
+	fileInfo, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Watcher sends dump without backup, full batch is sent by Add until API answers
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		if _, err := processFile(fileName, fileInfo, false); err != nil {
+			t.Errorf("processFile returned error %v", err)
+		}
+	}()
+	select {
+	case <-api.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch is not sent")
+	}
+	// Walker finds the same dump while batch is sent and asks to move it to backup
+	if _, err = processFile(fileName, fileInfo, true); err != nil {
+		t.Fatalf("processFile returned error %v", err)
+	}
+	close(api.release)
+	<-sent
+
+	if sizes, _ := api.batches(); len(sizes) != 1 {
+		t.Errorf("API received batches %v, expected one batch", sizes)
+	}
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("dump %s is not moved to backup", fileName)
+	}
+	if _, err := os.Stat(filepath.Join(config.BackupDir, "app", "dump.txt")); err != nil {
+		t.Errorf("dump is not found in backup: %v", err)
+	}
+}
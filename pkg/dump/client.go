@@ -0,0 +1,128 @@
+package dump
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/log"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	httpClient     *http.Client
+	httpClientOnce sync.Once
+)
+
+// getHTTPClient return shared http client for dump viewer API
+func getHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		httpClient = NewHTTPClient(root.GetConfig())
+	})
+	return httpClient
+}
+
+// NewHTTPClient create http client with timeouts, proxy and connection pool from config
+func NewHTTPClient(config *root.Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(config.APIConnectTimeout) * time.Second,
+		KeepAlive: time.Duration(config.APIKeepAlive) * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 proxyFunc(config.APIProxy, config.APINoProxy),
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   time.Duration(config.APIConnectTimeout) * time.Second,
+		ResponseHeaderTimeout: time.Duration(config.APIResponseTimeout) * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		MaxIdleConns:          config.APIMaxIdleConns,
+		MaxIdleConnsPerHost:   config.APIMaxIdleConnsPerHost,
+		MaxConnsPerHost:       config.APIMaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(config.APIIdleConnTimeout) * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(config.APITimeout) * time.Second,
+	}
+}
+
+// proxyFunc return proxy selector. Without configured proxy environment variables
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY are used
+func proxyFunc(proxy, noProxy string) func(*http.Request) (*url.URL, error) {
+	if proxy == "" {
+		return http.ProxyFromEnvironment
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || proxyURL.Host == "" {
+		log.Error(fmt.Sprintf("Invalid proxy url %s. Using proxy from environment", proxy))
+		return http.ProxyFromEnvironment
+	}
+	if noProxy == "" {
+		noProxy = os.Getenv("NO_PROXY")
+		if noProxy == "" {
+			noProxy = os.Getenv("no_proxy")
+		}
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Hostname(), noProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}
+}
+
+// bypassProxy check host in comma separated NO_PROXY list (hosts, domain suffixes, ip and cidr)
+func bypassProxy(host, noProxy string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if ip != nil {
+			if entryIP := net.ParseIP(entry); entryIP != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(entry, "*")
+		if host == strings.TrimPrefix(entry, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// closeResponse drain and close response body for reuse keep-alive connection
+func closeResponse(response *http.Response) {
+	if response == nil || response.Body == nil {
+		return
+	}
+	_, err := io.Copy(ioutil.Discard, io.LimitReader(response.Body, maxResponseBodySize))
+	if err != nil {
+		log.Debug(fmt.Sprintf("Error drain response body. %s", err.Error()))
+	}
+	err = response.Body.Close()
+	if err != nil {
+		log.Debug(fmt.Sprintf("Error close response body. %s", err.Error()))
+	}
+}
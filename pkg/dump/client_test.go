@@ -0,0 +1,32 @@
+package dump
+
+import "testing"
+
+func TestBypassProxy(t *testing.T) {
+	tests := []struct {
+		host    string
+		noProxy string
+		bypass  bool
+	}{
+		{"viewer.local", "", false},
+		{"viewer.local", "*", true},
+		{"viewer.local", "viewer.local", true},
+		{"Viewer.Local", "viewer.local", true},
+		{"api.viewer.local", "viewer.local", true},
+		{"api.viewer.local", ".viewer.local", true},
+		{"api.viewer.local", "*.viewer.local", true},
+		{"viewer.local", "other.local, viewer.local:8080", true},
+		{"myviewer.local", "viewer.local", false},
+		{"10.1.2.3", "10.1.2.3", true},
+		{"10.1.2.3", "10.0.0.0/8", true},
+		{"11.1.2.3", "10.0.0.0/8", false},
+		{"viewer.local", "10.0.0.0/8", false},
+		{"::1", "::1", true},
+		{"10.1.2.3", "10.1.2", false},
+	}
+	for _, test := range tests {
+		if bypass := bypassProxy(test.host, test.noProxy); bypass != test.bypass {
+			t.Errorf("bypassProxy(%q, %q) = %v, expected %v", test.host, test.noProxy, bypass, test.bypass)
+		}
+	}
+}
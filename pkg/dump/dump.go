@@ -3,11 +3,18 @@ package dump
 import (
 	"bytes"
 	root "dumpbeat/pkg"
+	"dumpbeat/pkg/checkpoint"
 	"dumpbeat/pkg/common"
+	"dumpbeat/pkg/exporter"
+	"dumpbeat/pkg/health"
+	"dumpbeat/pkg/limiter"
 	"dumpbeat/pkg/log"
+	"dumpbeat/pkg/readiness"
+	"dumpbeat/pkg/viewer"
 	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -27,39 +34,120 @@ type Dump struct {
 	FileSize        int64        `json:"file_size" bson:"file_size"`
 	BucketName      string       `json:"bucket_name" bson:"bucket_name"`
 	Date            time.Time    `json:"date" bson:"date"`
+	IdempotencyKey  string       `json:"idempotency_key" bson:"idempotency_key"`
+	RecordOffset    int64        `json:"record_offset" bson:"record_offset"`
+	RecordIndex     int          `json:"record_index" bson:"record_index"`
+	RecordCount     int          `json:"record_count,omitempty" bson:"record_count,omitempty"`
 	Config          *root.Config `json:"-"`
+	checkpoint      checkpoint.Entry
 }
 
-func (d Dump) apiUrl() string {
-	config := root.GetConfig()
-	appName := getAppName(d.Filename, d.RootDir)
-	if alias, ok := config.AliasesMap[appName]; ok {
-		appName = alias
-	}
-	return fmt.Sprintf("%s/%s/add", strings.TrimRight(d.Config.APIUrl, "/"), appName)
+// appName return application of dump renamed by configured aliases
+func (d Dump) appName() string {
+	return common.AppAlias(getAppName(d.Filename, d.RootDir))
+}
+
+// apiPath return path of add endpoint of dump application relative to dump viewer API url
+func (d Dump) apiPath() string {
+	return fmt.Sprintf("/%s/add", d.appName())
 }
 
-// SendDump to API
+// SendDump to API. Retryable failures are repeated up to configured retries count
 func (d Dump) SendDump() error {
 	jsonValue, err := json.Marshal(d)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", d.apiUrl(), bytes.NewBuffer(jsonValue))
+	_, err = deliver(d.appName(), d.apiPath(), "application/json", jsonValue, d.Filename, d.IdempotencyKey)
+	d.observeResult(err)
+	return err
+}
+
+// observeResult count sent or failed dump
+func (d Dump) observeResult(err error) {
+	app := d.appName()
 	if err != nil {
-		return err
+		reason, status := failureReason(err)
+		exporter.DumpsFailedCounter.WithLabelValues(app, reason, status).Inc()
+		return
+	}
+	exporter.DumpsSentCounter.WithLabelValues(app).Inc()
+	exporter.DumpAgeHistogram.WithLabelValues(app).Observe(time.Since(time.Unix(int64(d.DateCreatedFile), 0)).Seconds())
+}
+
+// deliver post body to path of dump viewer API honoring rate limits, circuit breaker and retries.
+// Every attempt goes to next viewer instance, so retries fail over to other instances. Returns response body
+func deliver(app, apiPath, contentType string, body []byte, name, idempotencyKey string) ([]byte, error) {
+	config := root.GetConfig()
+	for attempt := 0; ; attempt++ {
+		baseURL, err := viewer.Next()
+		if err != nil {
+			health.UploadFailed()
+			return nil, errors.Wrapf(err, "Error send dump %s", name)
+		}
+		url := baseURL + apiPath
+		endpoint := limiter.ForURL(url)
+		err = endpoint.Breaker.Allow()
+		if err != nil {
+			health.UploadFailed()
+			return nil, errors.Wrapf(err, "Error send dump %s to %s", name, endpoint.Name)
+		}
+		endpoint.Wait(len(body))
+		start := time.Now()
+		responseBody, err := post(url, contentType, body, idempotencyKey)
+		if err == nil {
+			exporter.UploadDurationHistogram.WithLabelValues(app, "success").Observe(time.Since(start).Seconds())
+			exporter.BytesSentCounter.WithLabelValues(app).Add(float64(len(body)))
+		} else {
+			exporter.UploadDurationHistogram.WithLabelValues(app, "error").Observe(time.Since(start).Seconds())
+		}
+		if err == nil || IsPermanent(err) {
+			endpoint.Breaker.Success()
+		} else {
+			endpoint.Breaker.Failure()
+		}
+		if err != nil && !IsPermanent(err) {
+			err = errors.Wrapf(err, "Error send dump to API %s", name)
+		}
+		if err == nil {
+			health.UploadSucceeded()
+			return responseBody, nil
+		}
+		if IsPermanent(err) {
+			// API answered, so rejected dump is a problem of the dump and not a failing upload. Counting it
+			// would keep agent critical on idle node where no later upload clears the failure
+			return responseBody, err
+		}
+		if attempt >= config.APIMaxRetries {
+			health.UploadFailed()
+			return responseBody, err
+		}
+		delay := retryDelay(err, attempt)
+		log.Info(fmt.Sprintf("%s. Retry send dump %s in %s", err.Error(), name, delay))
+		time.Sleep(delay)
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", d.Config.APIToken))
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	response, err := client.Do(req)
+}
+
+func post(url, contentType string, body []byte, idempotencyKey string) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		return errors.Wrapf(err, "Error send dump to API %s", d.Filename)
+		return nil, err
 	}
-	if response.StatusCode != http.StatusCreated {
-		return fmt.Errorf("dump not sended to %s %s", d.apiUrl(), response.Status)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", root.GetConfig().APIToken))
+	req.Header.Set("Content-Type", contentType)
+	if idempotencyKey != "" {
+		req.Header.Set(IdempotencyHeader, idempotencyKey)
 	}
-	return nil
+	response, err := getHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(response)
+	err = checkResponse(url, response)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(io.LimitReader(response.Body, maxResponseBodySize))
 }
 
 // Move dump to backup directory
@@ -77,6 +165,15 @@ func (d Dump) Move(fileInfo os.FileInfo) (err error) {
 			return errors.Wrapf(err, "Error move file %s to %s", d.Filename, path.Join(backupDir, fileInfo.Name()))
 		}
 	}
+	exporter.DumpsMovedCounter.WithLabelValues(d.appName()).Inc()
+	readiness.Forget(d.Filename)
+	checkpoint.Delete(d.Filename)
+	if readiness.Strategy(d.Filename) == readiness.StrategyMarker {
+		err = os.Remove(readiness.MarkerFile(d.Filename))
+		if err != nil && !os.IsNotExist(err) {
+			log.Error(fmt.Sprintf("%s: Error remove marker file. %s", d.Filename, err.Error()))
+		}
+	}
 	return nil
 }
 
@@ -93,13 +190,20 @@ func VisitFileWithoutWaitTime(fileName string, fileInfo os.FileInfo, err error)
 	if fileInfo.IsDir() {
 		return nil
 	}
+	if isTailFile(fileInfo.Name()) {
+		_, err := processTail(fileName, fileInfo)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error process tail of file %s", err.Error(), fileName))
+		}
+		return nil
+	}
 	matched, err := filepath.Match(config.PatternFileFilter, fileInfo.Name())
 	if err != nil {
 		return errors.Wrapf(err, "Error match pattern file filter in directory %s", fileInfo.Name())
 	}
 	if matched {
 		log.Debug(fmt.Sprintf("Time to processing %s", fileName))
-		err := processFile(fileName, fileInfo, false)
+		_, err := processFile(fileName, fileInfo, false)
 		if err != nil {
 			log.Error(fmt.Sprintf("%s. Error process file %s", err.Error(), fileName))
 			//! Посмотреть почему тут так сделано
@@ -117,16 +221,23 @@ func VisitFileWithWaitTime(fileName string, fileInfo os.FileInfo, err error) err
 	if fileInfo.IsDir() {
 		return nil
 	}
+	if isTailFile(fileInfo.Name()) {
+		_, err := processTail(fileName, fileInfo)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error process tail of file %s", err.Error(), fileName))
+		}
+		return nil
+	}
 	matched, err := filepath.Match(config.PatternFileFilter, fileInfo.Name())
 	if err != nil {
 		return errors.Wrapf(err, "Error match pattern file filter in directory %s", fileInfo.Name())
 	}
 	if matched {
-		if int(time.Since(fileInfo.ModTime()).Seconds()) < config.FileWaitTime {
+		if !readiness.For(fileName).Ready(fileName, fileInfo, time.Time{}) {
 			return nil
 		}
 		log.Debug(fmt.Sprintf("Time to processing %s", fileName))
-		err := processFile(fileName, fileInfo, true)
+		_, err := processFile(fileName, fileInfo, true)
 		if err != nil {
 			log.Error(fmt.Sprintf("%s. Error process file %s", err.Error(), fileName))
 			//! Посмотреть почему тут так сделано
@@ -136,7 +247,8 @@ func VisitFileWithWaitTime(fileName string, fileInfo os.FileInfo, err error) err
 	return nil
 }
 
-func processFile(fileName string, fileInfo os.FileInfo, backup bool) (err error) {
+// processFile send dump and move it to backup directory. Returns false when dump was already sent before
+func processFile(fileName string, fileInfo os.FileInfo, backup bool) (sent bool, err error) {
 	config := root.GetConfig()
 
 	var content []byte
@@ -145,13 +257,13 @@ func processFile(fileName string, fileInfo os.FileInfo, backup bool) (err error)
 		content, err = common.ReadBigFile(fileName)
 		if err != nil {
 			log.Error(err.Error())
-			return err
+			return false, err
 		}
 	} else {
 		content, err = ioutil.ReadFile(fileName)
 		if err != nil {
 			log.Error(err.Error())
-			return err
+			return false, err
 		}
 	}
 	year, month, _ := fileInfo.ModTime().Date()
@@ -165,17 +277,55 @@ func processFile(fileName string, fileInfo os.FileInfo, backup bool) (err error)
 		FileSize:        fileInfo.Size(),
 		BucketName:      bucketName,
 		Date:            time.Now(),
+		IdempotencyKey:  idempotencyKey(config.NodeName, fileName, fileInfo, content),
 		Config:          config,
+		checkpoint:      checkpoint.NewEntry(fileName, fileInfo, contentHash(content)),
+	}
+	previous, ok := checkpoint.Get(fileName)
+	if !ok {
+		exporter.DumpsDiscoveredCounter.WithLabelValues(d.appName()).Inc()
+	}
+	if ok && previous.Status == checkpoint.StatusSent && previous.SameFile(d.checkpoint) {
+		log.Info(fmt.Sprintf("Dump %s already sent, skip sending", fileName))
+		return false, finishDump(d, fileInfo, backup, nil)
+	}
+	checkpoint.Set(d.checkpoint, checkpoint.StatusPending)
+	if checkpoint.Acknowledged(d.IdempotencyKey) {
+		log.Info(fmt.Sprintf("Dump %s already acknowledged by API, skip sending", fileName))
+		return false, finishDump(d, fileInfo, backup, nil)
+	}
+	if s := splitterFor(fileName); s != nil {
+		if records := s.Split(content, 0, true); len(records) > 1 {
+			return true, finishDump(d, fileInfo, backup, sendRecords(d, fileInfo, records))
+		}
+	}
+	if config.BatchEnabled {
+		getBatcher().Add(d, fileInfo, backup)
+		return true, nil
+	}
+	return true, finishDump(d, fileInfo, backup, d.SendDump())
+}
+
+// finishDump move sent or rejected by API dump to backup directory
+func finishDump(d Dump, fileInfo os.FileInfo, backup bool, err error) error {
+	if err != nil && IsPermanent(err) && backup {
+		log.Error(fmt.Sprintf("%s : Dump rejected by API, moving %s to backup without retry", err.Error(), d.Filename))
+		moveErr := d.Move(fileInfo)
+		if moveErr != nil {
+			log.Error(fmt.Sprintf("%s : Error move file: %s\n", moveErr.Error(), d.Filename))
+		}
+		return err
 	}
-	err = d.SendDump()
 	if err != nil {
 		log.Error(fmt.Sprintf("%s : Error send dump", err.Error()))
 		return err
 	}
+	checkpoint.Acknowledge(d.IdempotencyKey)
+	checkpoint.Set(d.checkpoint, checkpoint.StatusSent)
 	if backup {
 		err = d.Move(fileInfo)
 		if err != nil {
-			log.Error(fmt.Sprintf("%s : Error move file: %s\n", err.Error(), fileName))
+			log.Error(fmt.Sprintf("%s : Error move file: %s\n", err.Error(), d.Filename))
 			return err
 		}
 	}
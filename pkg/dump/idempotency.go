@@ -0,0 +1,33 @@
+package dump
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// IdempotencyHeader is sent with idempotency key of dump so API can drop repeated uploads
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyKey return deterministic key from node name, path, size, modification time and content of dump file
+func idempotencyKey(nodeName, fileName string, fileInfo os.FileInfo, content []byte) string {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\x00%s\x00%d\x00%d\x00", nodeName, fileName, fileInfo.Size(), fileInfo.ModTime().UnixNano())
+	_, _ = hash.Write(content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordIdempotencyKey return key of record of tailed file. It doesn't depend on size and modification
+// time of the growing file, so record resent after file grows keeps its key
+func recordIdempotencyKey(nodeName, fileName string, offset int64, content []byte) string {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\x00%s\x00%d\x00%s", nodeName, fileName, offset, contentHash(content))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// contentHash return sha256 of dump content
+func contentHash(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
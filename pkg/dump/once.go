@@ -0,0 +1,70 @@
+package dump
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/log"
+	"dumpbeat/pkg/readiness"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Summary counts dumps processed by single walk of dump directory. Skipped are dumps sent before,
+// records are sent records of append-only dump logs
+type Summary struct {
+	Sent     int
+	Records  int
+	Skipped  int
+	Failed   int
+	NotReady int
+}
+
+// WalkOnce send all dumps of root directory and move them to backup directory. When wait is set
+// dumps which are not ready yet are skipped, otherwise all matched files are sent
+func WalkOnce(rootDir string, wait bool) (Summary, error) {
+	config := root.GetConfig()
+	summary := Summary{}
+	err := filepath.Walk(rootDir, func(fileName string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			log.Error(err.Error())
+			return nil
+		}
+		if fileInfo.IsDir() {
+			return nil
+		}
+		if isTailFile(fileInfo.Name()) {
+			records, err := processTail(fileName, fileInfo)
+			summary.Records += records
+			if err != nil {
+				log.Error(fmt.Sprintf("%s. Error process tail of file %s", err.Error(), fileName))
+				summary.Failed++
+			}
+			return nil
+		}
+		matched, err := filepath.Match(config.PatternFileFilter, fileInfo.Name())
+		if err != nil {
+			return err
+		}
+		if !matched {
+			return nil
+		}
+		if wait && !readiness.For(fileName).Ready(fileName, fileInfo, time.Time{}) {
+			summary.NotReady++
+			return nil
+		}
+		sent, err := processFile(fileName, fileInfo, true)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error process file %s", err.Error(), fileName))
+			summary.Failed++
+			return nil
+		}
+		if sent {
+			summary.Sent++
+		} else {
+			summary.Skipped++
+		}
+		return nil
+	})
+	return summary, err
+}
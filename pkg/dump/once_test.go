@@ -0,0 +1,151 @@
+package dump
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/health"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testAPI accept dumps with 201 and reject dumps with "bad" in file name with 400. Payloads of accepted
+// dumps are kept as decoded JSON objects
+type testAPI struct {
+	*httptest.Server
+	payloads []map[string]interface{}
+	mux      sync.Mutex
+}
+
+func newTestAPI() *testAPI {
+	api := &testAPI{}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if filename, _ := payload["filename"].(string); err != nil || strings.Contains(filename, "bad") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		api.mux.Lock()
+		api.payloads = append(api.payloads, payload)
+		api.mux.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	return api
+}
+
+// received return payloads of accepted dumps and forget them
+func (api *testAPI) received() []map[string]interface{} {
+	api.mux.Lock()
+	defer api.mux.Unlock()
+	payloads := api.payloads
+	api.payloads = nil
+	return payloads
+}
+
+// setTestConfig use temporary dump, backup and data directories and test API
+func setTestConfig(t *testing.T, api *testAPI) (*root.Config, func()) {
+	tmpDir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &root.Config{
+		DumpDir:           filepath.Join(tmpDir, "dumps"),
+		BackupDir:         filepath.Join(tmpDir, "backup"),
+		DataDir:           filepath.Join(tmpDir, "data"),
+		APIUrl:            api.URL,
+		PatternFileFilter: "*.txt",
+		TailPattern:       "*.log",
+		TailDelimiter:     `\n`,
+		MaxFileSize:       15,
+		NodeName:          "node",
+		FileWaitTime:      3600,
+		AliasesMap:        map[string]string{},
+	}
+	root.SetConfig(config)
+	return config, func() {
+		_ = os.RemoveAll(tmpDir)
+	}
+}
+
+func writeTestFile(t *testing.T, fileName, content string, flag int) {
+	err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteString(content)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWalkOnceSummary(t *testing.T) {
+	api := newTestAPI()
+	defer api.Close()
+	config, cleanup := setTestConfig(t, api)
+	defer cleanup()
+	old := time.Now().Add(-2 * time.Hour)
+	write := func(name, content string, modTime time.Time) {
+		fileName := filepath.Join(config.DumpDir, name)
+		writeTestFile(t, fileName, content, os.O_TRUNC)
+		if err := os.Chtimes(fileName, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendTail := func(name, content string) {
+		writeTestFile(t, filepath.Join(config.DumpDir, name), content, os.O_APPEND)
+	}
+	tests := []struct {
+		name    string
+		prepare func()
+		wait    bool
+		summary Summary
+	}{
+		{"dumps sent and rejected", func() {
+			write("app/a.txt", "a", old)
+			write("app/b.txt", "b", old)
+			write("app/bad.txt", "bad", old)
+		}, true, Summary{Sent: 2, Failed: 1}},
+		{"acknowledged dump skipped", func() {
+			write("app/a.txt", "a", old)
+			write("app/c.txt", "c", old)
+		}, true, Summary{Sent: 1, Skipped: 1}},
+		{"tail records counted", func() {
+			appendTail("app/app.log", "one\ntwo\nthree\n")
+		}, true, Summary{Records: 3}},
+		{"only appended tail records", func() {
+			appendTail("app/app.log", "four\nfive\n")
+		}, true, Summary{Records: 2}},
+		{"not ready dump", func() {
+			write("app/new.txt", "new", time.Now())
+		}, true, Summary{NotReady: 1}},
+		{"not ready dump sent without wait", func() {}, false, Summary{Sent: 1}},
+	}
+	for _, test := range tests {
+		test.prepare()
+		summary, err := WalkOnce(config.DumpDir, test.wait)
+		if err != nil {
+			t.Errorf("%s: WalkOnce returned error %v", test.name, err)
+		}
+		if summary != test.summary {
+			t.Errorf("%s: summary %+v, expected %+v", test.name, summary, test.summary)
+		}
+		// Rejected dumps are not failing uploads, otherwise idle node stays critical
+		if report := health.Status(); report.FailingSince != nil {
+			t.Errorf("%s: uploads failing since %s", test.name, report.FailingSince)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package dump
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/common"
+	"dumpbeat/pkg/log"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// replayedFile describes dump restored from backup directory or archive
+type replayedFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (f replayedFile) Name() string       { return filepath.Base(f.name) }
+func (f replayedFile) Size() int64        { return f.size }
+func (f replayedFile) Mode() os.FileMode  { return 0644 }
+func (f replayedFile) ModTime() time.Time { return f.modTime }
+func (f replayedFile) IsDir() bool        { return false }
+func (f replayedFile) Sys() interface{}   { return nil }
+
+// Replay send dump restored from backup directory or archive. File name is original path of dump in dump directory.
+// Acknowledgements and registry are not checked, dump is always sent
+func Replay(fileName string, content []byte, modTime time.Time) error {
+	config := root.GetConfig()
+	fileInfo := replayedFile{name: fileName, size: int64(len(content)), modTime: modTime}
+	if fileInfo.Size() > int64(config.MaxFileSize*1048576) {
+		log.Info(fmt.Sprintf("File %s exceeds maximum size %d.\n", fileName, config.MaxFileSize))
+		content = common.TruncateBigFile(content)
+	}
+	year, month, _ := modTime.Date()
+	d := Dump{
+		Content:         string(content),
+		Filename:        fileName,
+		DateCreatedFile: int32(modTime.Unix()),
+		NodeName:        config.NodeName,
+		RootDir:         config.DumpDir,
+		FileSize:        fileInfo.Size(),
+		BucketName:      fmt.Sprintf("dumps-%d-%d", year, month),
+		Date:            time.Now(),
+		IdempotencyKey:  idempotencyKey(config.NodeName, fileName, fileInfo, content),
+		Config:          config,
+	}
+	return d.SendDump()
+}
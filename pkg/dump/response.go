@@ -0,0 +1,144 @@
+package dump
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/limiter"
+	"dumpbeat/pkg/viewer"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	responseBodySnippetSize = 512
+	maxResponseBodySize     = 1 << 20
+)
+
+// ResponseError is returned when dump viewer API answered with unsuccessful status
+type ResponseError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Body       string
+	Retryable  bool
+	RetryAfter time.Duration
+}
+
+func (e *ResponseError) Error() string {
+	kind := "permanent"
+	if e.Retryable {
+		kind = "retryable"
+	}
+	if e.Body == "" {
+		return fmt.Sprintf("dump not sended to %s %s (%s)", e.URL, e.Status, kind)
+	}
+	return fmt.Sprintf("dump not sended to %s %s (%s): %s", e.URL, e.Status, kind, e.Body)
+}
+
+// IsPermanent report whether error can't be fixed by resending the same dump
+func IsPermanent(err error) bool {
+	if responseErr, ok := errors.Cause(err).(*ResponseError); ok {
+		return !responseErr.Retryable
+	}
+	return false
+}
+
+// failureReason return reason and HTTP status of failed upload for metrics
+func failureReason(err error) (string, string) {
+	cause := errors.Cause(err)
+	if responseErr, ok := cause.(*ResponseError); ok {
+		status := ""
+		if responseErr.StatusCode != 0 {
+			status = strconv.Itoa(responseErr.StatusCode)
+		}
+		if responseErr.Retryable {
+			return "http", status
+		}
+		return "rejected", status
+	}
+	switch cause {
+	case limiter.ErrCircuitOpen:
+		return "circuit_open", ""
+	case viewer.ErrNoInstances:
+		return "no_instance", ""
+	}
+	return "network", ""
+}
+
+// checkResponse classify API response by configured success codes
+func checkResponse(url string, response *http.Response) error {
+	if isSuccessCode(response.StatusCode) {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, responseBodySnippetSize))
+	responseErr := &ResponseError{
+		URL:        url,
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Body:       strings.TrimSpace(string(body)),
+		Retryable:  isRetryableCode(response.StatusCode),
+	}
+	if responseErr.Retryable {
+		responseErr.RetryAfter = parseRetryAfter(response.Header.Get("Retry-After"))
+	}
+	return responseErr
+}
+
+func isSuccessCode(code int) bool {
+	config := root.GetConfig()
+	if config.APISuccessCodes == "" {
+		return code == http.StatusCreated
+	}
+	for _, item := range strings.Split(config.APISuccessCodes, ",") {
+		successCode, err := strconv.Atoi(strings.TrimSpace(item))
+		if err == nil && successCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableCode report whether the same dump can be accepted later: request timeout, too many requests
+// and server errors. Other client errors are permanent rejections
+func isRetryableCode(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// parseRetryAfter parse Retry-After header in seconds or http date format
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// retryDelay return delay before next attempt honoring Retry-After
+func retryDelay(err error, attempt int) time.Duration {
+	config := root.GetConfig()
+	delay := time.Duration(config.APIRetryBackoff) * time.Second << uint(attempt)
+	if responseErr, ok := errors.Cause(err).(*ResponseError); ok && responseErr.RetryAfter > 0 {
+		delay = responseErr.RetryAfter
+	}
+	maxDelay := time.Duration(config.APIMaxRetryAfter) * time.Second
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
@@ -0,0 +1,96 @@
+package dump
+
+import (
+	"dumpbeat/pkg/limiter"
+	"dumpbeat/pkg/viewer"
+	"github.com/pkg/errors"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableCode(t *testing.T) {
+	tests := []struct {
+		code      int
+		retryable bool
+	}{
+		{400, false},
+		{413, false},
+		{422, false},
+		{401, false},
+		{403, false},
+		{404, false},
+		{405, false},
+		{409, false},
+		{410, false},
+		{408, true},
+		{429, true},
+		{500, true},
+		{502, true},
+		{503, true},
+	}
+	for _, test := range tests {
+		if retryable := isRetryableCode(test.code); retryable != test.retryable {
+			t.Errorf("isRetryableCode(%d) = %v, expected %v", test.code, retryable, test.retryable)
+		}
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		reason string
+		status string
+	}{
+		{"rejected", &ResponseError{StatusCode: 413}, "rejected", "413"},
+		{"retryable", &ResponseError{StatusCode: 503, Retryable: true}, "http", "503"},
+		{"wrapped", errors.Wrap(&ResponseError{StatusCode: 422}, "Error send dump"), "rejected", "422"},
+		{"missing item result", &ResponseError{Retryable: true}, "http", ""},
+		{"circuit open", errors.Wrap(limiter.ErrCircuitOpen, "Error send dump"), "circuit_open", ""},
+		{"no instance", errors.Wrap(viewer.ErrNoInstances, "consul service viewer"), "no_instance", ""},
+		{"network", errors.New("connection refused"), "network", ""},
+	}
+	for _, test := range tests {
+		reason, status := failureReason(test.err)
+		if reason != test.reason || status != test.status {
+			t.Errorf("%s: failureReason() = %s, %q, expected %s, %q", test.name, reason, status, test.reason, test.status)
+		}
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{"rejected", &ResponseError{StatusCode: 400}, true},
+		{"wrapped rejected", errors.Wrap(&ResponseError{StatusCode: 400}, "Error send dump"), true},
+		{"retryable", &ResponseError{StatusCode: 500, Retryable: true}, false},
+		{"network", errors.New("connection refused"), false},
+	}
+	for _, test := range tests {
+		if permanent := IsPermanent(test.err); permanent != test.permanent {
+			t.Errorf("%s: IsPermanent() = %v, expected %v", test.name, permanent, test.permanent)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		delay time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{" 5 ", 5 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{"Mon, 02 Jan 2006 15:04:05 GMT", 0},
+	}
+	for _, test := range tests {
+		if delay := parseRetryAfter(test.value); delay != test.delay {
+			t.Errorf("parseRetryAfter(%q) = %v, expected %v", test.value, delay, test.delay)
+		}
+	}
+}
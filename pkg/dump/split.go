@@ -0,0 +1,75 @@
+package dump
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/checkpoint"
+	"dumpbeat/pkg/log"
+	"dumpbeat/pkg/splitter"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	splitters    = make(map[string]*splitter.Splitter)
+	splittersMux sync.Mutex
+)
+
+// splitterFor return splitter configured for app of dump file or nil
+func splitterFor(fileName string) *splitter.Splitter {
+	config := root.GetConfig()
+	name := config.Splitter
+	if appSplitter, ok := config.SplitterMap[getAppName(fileName, config.DumpDir)]; ok {
+		name = appSplitter
+	}
+	if name == "" || name == "none" {
+		return nil
+	}
+	splittersMux.Lock()
+	defer splittersMux.Unlock()
+	if s, ok := splitters[name]; ok {
+		return s
+	}
+	s, err := splitter.NewPreset(name, config.SplitterStart, config.SplitterEnd)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Dumps will be sent without splitting", err.Error()))
+	}
+	splitters[name] = s
+	return s
+}
+
+// ResetSplitters drop cached splitters, so changed splitter settings take effect
+func ResetSplitters() {
+	splittersMux.Lock()
+	defer splittersMux.Unlock()
+	splitters = make(map[string]*splitter.Splitter)
+}
+
+// sendRecords send every record of file as separate dump. Records acknowledged on previous
+// attempts are skipped. Retryable error stops sending, permanent error is returned after all records
+func sendRecords(d Dump, fileInfo os.FileInfo, records []splitter.Record) error {
+	var permanentErr error
+	for _, r := range records {
+		rd := d
+		rd.Content = string(r.Content)
+		rd.FileSize = r.Length
+		rd.RecordIndex = r.Index
+		rd.RecordCount = len(records)
+		rd.RecordOffset = r.Offset
+		rd.IdempotencyKey = idempotencyKey(d.NodeName, fmt.Sprintf("%s#%d", d.Filename, r.Index), fileInfo, r.Content)
+		if checkpoint.Acknowledged(rd.IdempotencyKey) {
+			continue
+		}
+		err := rd.SendDump()
+		if err != nil && !IsPermanent(err) {
+			return err
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("%s : Record %d of %s rejected by API", err.Error(), r.Index, d.Filename))
+			permanentErr = err
+			continue
+		}
+		checkpoint.Acknowledge(rd.IdempotencyKey)
+	}
+	return permanentErr
+}
@@ -0,0 +1,67 @@
+package dump
+
+import (
+	root "dumpbeat/pkg"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSendRecordsPayload(t *testing.T) {
+	api := newTestAPI()
+	defer api.Close()
+	config, cleanup := setTestConfig(t, api)
+	defer cleanup()
+	config.Splitter = "custom"
+	config.SplitterStart = "^dump "
+	config.MaxFileSize = 1000
+	root.SetConfig(config)
+	ResetSplitters()
+	defer ResetSplitters()
+	fileName := filepath.Join(config.DumpDir, "app", "dumps.txt")
+	writeTestFile(t, fileName, "dump one\nline\ndump two\nline\ndump three\nline\n", os.O_TRUNC)
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(fileName, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := WalkOnce(config.DumpDir, true); err != nil {
+		t.Fatalf("WalkOnce returned error %v", err)
+	}
+	payloads := api.received()
+	if len(payloads) != 3 {
+		t.Fatalf("API received %d payloads, expected 3", len(payloads))
+	}
+	sort.Slice(payloads, func(i, j int) bool {
+		left, _ := payloads[i]["record_offset"].(float64)
+		right, _ := payloads[j]["record_offset"].(float64)
+		return left < right
+	})
+	expected := []struct {
+		content string
+		offset  float64
+	}{
+		{"dump one\nline\n", 0},
+		{"dump two\nline\n", 14},
+		{"dump three\nline\n", 28},
+	}
+	for i, test := range expected {
+		payload := payloads[i]
+		// Index and offset of the first record are zero and must still be sent
+		index, ok := payload["record_index"]
+		if !ok || index != float64(i) {
+			t.Errorf("record %d has record_index %v (present %v), expected %d", i, index, ok, i)
+		}
+		if offset, ok := payload["record_offset"]; !ok || offset != test.offset {
+			t.Errorf("record %d has record_offset %v (present %v), expected %v", i, offset, ok, test.offset)
+		}
+		if count := payload["record_count"]; count != float64(len(expected)) {
+			t.Errorf("record %d has record_count %v, expected %d", i, count, len(expected))
+		}
+		if content := payload["content"]; content != test.content {
+			t.Errorf("record %d has content %q, expected %q", i, content, test.content)
+		}
+	}
+}
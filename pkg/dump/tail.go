@@ -0,0 +1,234 @@
+package dump
+
+import (
+	"bytes"
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/checkpoint"
+	"dumpbeat/pkg/log"
+	"dumpbeat/pkg/splitter"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// record is part of tailed file sent as separate dump
+type record struct {
+	offset  int64
+	length  int64
+	content []byte
+}
+
+var (
+	tailMux            sync.Mutex
+	multilineStart     *splitter.Splitter
+	multilineStartOnce sync.Once
+)
+
+// isTailFile report whether file is append-only dump log processed in tail mode
+func isTailFile(name string) bool {
+	config := root.GetConfig()
+	if config.TailPattern == "" {
+		return false
+	}
+	matched, err := filepath.Match(config.TailPattern, name)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Error match tail pattern %s", err.Error(), config.TailPattern))
+		return false
+	}
+	return matched
+}
+
+// getMultilineStart return splitter by multi-line start pattern or splitter preset name
+func getMultilineStart() *splitter.Splitter {
+	multilineStartOnce.Do(func() {
+		config := root.GetConfig()
+		if config.TailMultilineStart == "" {
+			return
+		}
+		var err error
+		multilineStart, err = splitter.NewPreset(config.TailMultilineStart, "", "")
+		if err == nil {
+			return
+		}
+		multilineStart, err = splitter.New(config.TailMultilineStart, "")
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error compile multiline start pattern %s", err.Error(), config.TailMultilineStart))
+		}
+	})
+	return multilineStart
+}
+
+// tailDelimiter return records delimiter with escape sequences like \n replaced
+func tailDelimiter() []byte {
+	delimiter := root.GetConfig().TailDelimiter
+	if unquoted, err := strconv.Unquote(`"` + delimiter + `"`); err == nil {
+		return []byte(unquoted)
+	}
+	return []byte(delimiter)
+}
+
+// processTail send records appended to file since last saved offset. Rotated file is read
+// to the end before new file, truncated file is read from the beginning. Returns count of sent records
+func processTail(fileName string, fileInfo os.FileInfo) (int, error) {
+	tailMux.Lock()
+	defer tailMux.Unlock()
+	config := root.GetConfig()
+	entry := checkpoint.NewEntry(fileName, fileInfo, "")
+	previous, ok := checkpoint.Get(fileName)
+	sent := 0
+	if ok && previous.Status == checkpoint.StatusTail {
+		if previous.Device == entry.Device && previous.Inode == entry.Inode {
+			entry.Offset = previous.Offset
+			if fileInfo.Size() < entry.Offset {
+				log.Info(fmt.Sprintf("File %s was truncated, read from the beginning", fileName))
+				entry.Offset = 0
+			}
+		} else {
+			log.Info(fmt.Sprintf("File %s was rotated, read from the beginning", fileName))
+			sent = rotatedTail(previous)
+		}
+	}
+	final := time.Since(fileInfo.ModTime()) >= time.Duration(config.TailRecordTimeout)*time.Second
+	records, err := sendTail(fileName, fileInfo, entry, final)
+	return sent + records, err
+}
+
+// rotatedTail send rest of rotated file found by identity in the same directory. Returns count of sent records
+func rotatedTail(previous checkpoint.Entry) int {
+	entries, err := ioutil.ReadDir(filepath.Dir(previous.Path))
+	if err != nil {
+		log.Error(err.Error())
+		return 0
+	}
+	for _, fileInfo := range entries {
+		rotatedName := filepath.Join(filepath.Dir(previous.Path), fileInfo.Name())
+		rotated := checkpoint.NewEntry(rotatedName, fileInfo, "")
+		if fileInfo.IsDir() || rotated.Device != previous.Device || rotated.Inode != previous.Inode {
+			continue
+		}
+		sent := 0
+		if fileInfo.Size() > previous.Offset {
+			rotated.Offset = previous.Offset
+			sent, err = sendTail(rotatedName, fileInfo, rotated, true)
+			if err != nil {
+				log.Error(fmt.Sprintf("%s. Error send rest of rotated file %s", err.Error(), rotatedName))
+			}
+			checkpoint.Delete(rotatedName)
+		}
+		return sent
+	}
+	return 0
+}
+
+// sendTail read file from entry offset and send complete records saving offset after each one.
+// Returns count of sent records
+func sendTail(fileName string, fileInfo os.FileInfo, entry checkpoint.Entry, final bool) (int, error) {
+	config := root.GetConfig()
+	if fileInfo.Size() <= entry.Offset {
+		checkpoint.Set(entry, checkpoint.StatusTail)
+		return 0, nil
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Error open file %s", fileName)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Error(err.Error())
+		}
+	}()
+	_, err = file.Seek(entry.Offset, io.SeekStart)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Error seek file %s to %d", fileName, entry.Offset)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(file, fileInfo.Size()-entry.Offset))
+	if err != nil {
+		return 0, errors.Wrapf(err, "Error read file %s", fileName)
+	}
+	sent := 0
+	for _, r := range splitRecords(data, entry.Offset, tailDelimiter(), getMultilineStart(), final) {
+		content := r.content
+		if len(content) > config.MaxFileSize*1048576 {
+			log.Info(fmt.Sprintf("Record of %s at offset %d exceeds maximum size %d", fileName, r.offset, config.MaxFileSize))
+			content = content[:config.MaxFileSize*1048576]
+		}
+		if len(bytes.TrimSpace(content)) > 0 {
+			d := newRecordDump(fileName, fileInfo, content, r.offset)
+			if !checkpoint.Acknowledged(d.IdempotencyKey) {
+				err = d.SendDump()
+				if err != nil && !IsPermanent(err) {
+					return sent, errors.Wrapf(err, "Error send record of %s at offset %d", fileName, r.offset)
+				}
+				if err != nil {
+					// Resending rejected record can't succeed and would block following records
+					log.Error(fmt.Sprintf("%s : Record of %s at offset %d rejected by API, skipped", err.Error(), fileName, r.offset))
+				} else {
+					checkpoint.Acknowledge(d.IdempotencyKey)
+					sent++
+				}
+			}
+		}
+		entry.Offset = r.offset + r.length
+		checkpoint.Set(entry, checkpoint.StatusTail)
+	}
+	return sent, nil
+}
+
+func newRecordDump(fileName string, fileInfo os.FileInfo, content []byte, offset int64) Dump {
+	config := root.GetConfig()
+	year, month, _ := fileInfo.ModTime().Date()
+	return Dump{
+		Content:         string(content),
+		Filename:        fileName,
+		DateCreatedFile: int32(fileInfo.ModTime().Unix()),
+		NodeName:        config.NodeName,
+		RootDir:         config.DumpDir,
+		FileSize:        int64(len(content)),
+		BucketName:      fmt.Sprintf("dumps-%d-%d", year, month),
+		Date:            time.Now(),
+		IdempotencyKey:  recordIdempotencyKey(config.NodeName, fileName, offset, content),
+		RecordOffset:    offset,
+		Config:          config,
+	}
+}
+
+// splitRecords split data read from offset into records by delimiter or multi-line start pattern.
+// Last record is returned only when final is set, because it may be still written
+func splitRecords(data []byte, offset int64, delimiter []byte, start *splitter.Splitter, final bool) []record {
+	var records []record
+	var begin int
+	switch {
+	case len(delimiter) > 0:
+		for {
+			index := bytes.Index(data[begin:], delimiter)
+			if index < 0 {
+				break
+			}
+			end := begin + index + len(delimiter)
+			records = append(records, record{offset: offset + int64(begin), length: int64(end - begin), content: data[begin : begin+index]})
+			begin = end
+		}
+	case start != nil:
+		for _, r := range start.Split(data, offset, final) {
+			records = append(records, record{offset: r.Offset, length: r.Length, content: r.Content})
+			begin = int(r.Offset-offset) + int(r.Length)
+		}
+		return records
+	default:
+		// Without delimiter complete lines appended since last read are one record
+		if index := bytes.LastIndexByte(data, '\n'); index >= 0 && !final {
+			records = append(records, record{offset: offset, length: int64(index + 1), content: data[:index+1]})
+			begin = index + 1
+		}
+	}
+	if final && begin < len(data) {
+		records = append(records, record{offset: offset + int64(begin), length: int64(len(data) - begin), content: data[begin:]})
+	}
+	return records
+}
@@ -0,0 +1,129 @@
+package dump
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/checkpoint"
+	"dumpbeat/pkg/splitter"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitRecords(t *testing.T) {
+	start, err := splitter.New("^Exception", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		data      string
+		offset    int64
+		delimiter string
+		start     *splitter.Splitter
+		final     bool
+		expected  []record
+	}{
+		{"delimiter keeps incomplete record", "one\ntwo\npart", 10, "\n", nil, false, []record{
+			{10, 4, []byte("one")},
+			{14, 4, []byte("two")},
+		}},
+		{"delimiter with final record", "one\npart", 0, "\n", nil, true, []record{
+			{0, 4, []byte("one")},
+			{4, 4, []byte("part")},
+		}},
+		{"multi-byte delimiter", "a\n--\nb\n--\n", 0, "--\n", nil, false, []record{
+			{0, 5, []byte("a\n")},
+			{5, 5, []byte("b\n")},
+		}},
+		{"no complete record", "part", 0, "\n", nil, false, nil},
+		{"multi-line start", "Exception 1\n at a\nException 2\n at b\n", 5, "", start, false, []record{
+			{5, 18, []byte("Exception 1\n at a\n")},
+		}},
+		{"multi-line start final", "Exception 1\n at a\nException 2\n at b\n", 5, "", start, true, []record{
+			{5, 18, []byte("Exception 1\n at a\n")},
+			{23, 18, []byte("Exception 2\n at b\n")},
+		}},
+		{"complete lines without delimiter", "one\ntwo\npart", 3, "", nil, false, []record{
+			{3, 8, []byte("one\ntwo\n")},
+		}},
+		{"final without delimiter", "one\npart", 3, "", nil, true, []record{
+			{3, 8, []byte("one\npart")},
+		}},
+	}
+	for _, test := range tests {
+		records := splitRecords([]byte(test.data), test.offset, []byte(test.delimiter), test.start, test.final)
+		if !reflect.DeepEqual(records, test.expected) {
+			t.Errorf("%s: splitRecords returned %v, expected %v", test.name, records, test.expected)
+		}
+	}
+}
+
+func TestProcessTailOffsets(t *testing.T) {
+	api := newTestAPI()
+	defer api.Close()
+	config, cleanup := setTestConfig(t, api)
+	defer cleanup()
+	config.TailRecordTimeout = 3600
+	root.SetConfig(config)
+	fileName := filepath.Join(config.DumpDir, "app", "app.log")
+	rotatedName := fileName + ".1"
+
+	tests := []struct {
+		name    string
+		prepare func()
+		records []string
+		offsets []float64
+		offset  int64
+	}{
+		{"incomplete record is kept", func() {
+			writeTestFile(t, fileName, "one\ntwo\npart", os.O_TRUNC)
+		}, []string{"one", "two"}, []float64{0, 4}, 8},
+		{"completed record", func() {
+			writeTestFile(t, fileName, "ial\n", os.O_APPEND)
+		}, []string{"partial"}, []float64{8}, 16},
+		{"nothing appended", func() {}, nil, nil, 16},
+		{"rotated file is read to the end before new file", func() {
+			if err := os.Rename(fileName, rotatedName); err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, rotatedName, "rest\n", os.O_APPEND)
+			writeTestFile(t, fileName, "new\n", os.O_TRUNC)
+		}, []string{"rest", "new"}, []float64{16, 0}, 4},
+		{"truncated file is read from the beginning", func() {
+			writeTestFile(t, fileName, "x\n", os.O_TRUNC)
+		}, []string{"x"}, []float64{0}, 2},
+	}
+	for _, test := range tests {
+		test.prepare()
+		fileInfo, err := os.Stat(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent, err := processTail(fileName, fileInfo)
+		if err != nil {
+			t.Errorf("%s: processTail returned error %v", test.name, err)
+		}
+		if sent != len(test.records) {
+			t.Errorf("%s: processTail sent %d records, expected %d", test.name, sent, len(test.records))
+		}
+		var records []string
+		var offsets []float64
+		for _, payload := range api.received() {
+			content, _ := payload["content"].(string)
+			offset, _ := payload["record_offset"].(float64)
+			records = append(records, content)
+			offsets = append(offsets, offset)
+		}
+		if !reflect.DeepEqual(records, test.records) || !reflect.DeepEqual(offsets, test.offsets) {
+			t.Errorf("%s: API received records %q at %v, expected %q at %v", test.name, records, offsets, test.records, test.offsets)
+		}
+		entry, ok := checkpoint.Get(fileName)
+		if !ok || entry.Status != checkpoint.StatusTail || entry.Offset != test.offset {
+			t.Errorf("%s: stored entry %+v (found %v), expected tail offset %d", test.name, entry, ok, test.offset)
+		}
+	}
+	if _, ok := checkpoint.Get(rotatedName); ok {
+		t.Errorf("entry of read rotated file %s is kept", rotatedName)
+	}
+}
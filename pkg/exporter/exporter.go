@@ -1,6 +1,7 @@
 package exporter
 
 import (
+	root "dumpbeat/pkg"
 	"dumpbeat/pkg/log"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
@@ -16,13 +17,162 @@ var (
 		prometheus.GaugeOpts{
 			Namespace: "dumpbeat",
 			Name:      "count_files_in_dump_directory",
-			Help:      "Count files in dump root folder",
+			Help:      "Count dump files matching pattern file filter in dump directory",
 		})
+	CircuitBreakerStateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "dumpbeat",
+			Name:      "circuit_breaker_state",
+			Help:      "Circuit breaker state of dump viewer API endpoint (0 - closed, 1 - half-open, 2 - open)",
+		}, []string{"endpoint"})
+	WatchedDirectoriesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "dumpbeat",
+			Name:      "watched_directories",
+			Help:      "Count directories watched by filesystem watcher",
+		})
+	PendingFilesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "dumpbeat",
+			Name:      "pending_files",
+			Help:      "Count files waiting until they are completely written",
+		})
+	MaxUserWatchesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "dumpbeat",
+			Name:      "max_user_watches",
+			Help:      "Inotify watches limit (fs.inotify.max_user_watches)",
+		})
+	JobLastRunGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "dumpbeat",
+			Name:      "job_last_run_timestamp_seconds",
+			Help:      "Start time of last run of scheduled job",
+		}, []string{"job"})
+	JobDurationGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "dumpbeat",
+			Name:      "job_last_duration_seconds",
+			Help:      "Duration of last run of scheduled job",
+		}, []string{"job"})
+	JobLastSuccessGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "dumpbeat",
+			Name:      "job_last_success",
+			Help:      "Result of last run of scheduled job (1 - success, 0 - error)",
+		}, []string{"job"})
+	JobRunsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dumpbeat",
+			Name:      "job_runs_total",
+			Help:      "Count runs of scheduled job by result (success, error, skipped)",
+		}, []string{"job", "result"})
+	RetentionReclaimedBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dumpbeat",
+			Name:      "retention_reclaimed_bytes_total",
+			Help:      "Bytes reclaimed by deletion of archives and backups by reason (age, size, count, watermark)",
+		}, []string{"kind", "reason"})
+	RetentionDeletedFilesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dumpbeat",
+			Name:      "retention_deleted_files_total",
+			Help:      "Count archives and backups deleted by retention policy by reason",
+		}, []string{"kind", "reason"})
+	BackupDiskUsageGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "dumpbeat",
+			Name:      "backup_disk_usage_percent",
+			Help:      "Used space of backup directory filesystem in percents",
+		})
+	ViewerInstancesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "dumpbeat",
+			Name:      "viewer_instances",
+			Help:      "Count healthy dump viewer API instances discovered in consul",
+		})
+	DumpsDiscoveredCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dumpbeat",
+			Name:      "dumps_discovered_total",
+			Help:      "Count new dump files found in dump directory",
+		}, []string{"app"})
+	DumpsSentCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dumpbeat",
+			Name:      "dumps_sent_total",
+			Help:      "Count dumps and records accepted by dump viewer API",
+		}, []string{"app"})
+	DumpsFailedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dumpbeat",
+			Name:      "dumps_failed_total",
+			Help:      "Count dumps and records not sent after retries by reason (network, http, rejected, circuit_open, no_instance) and HTTP status",
+		}, []string{"app", "reason", "status"})
+	DumpsMovedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dumpbeat",
+			Name:      "dumps_moved_total",
+			Help:      "Count dumps moved to backup directory",
+		}, []string{"app"})
+	DumpsArchivedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dumpbeat",
+			Name:      "dumps_archived_total",
+			Help:      "Count dumps added to archives",
+		}, []string{"app"})
+	BytesSentCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dumpbeat",
+			Name:      "bytes_sent_total",
+			Help:      "Bytes of requests accepted by dump viewer API",
+		}, []string{"app"})
+	UploadDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "dumpbeat",
+			Name:      "upload_duration_seconds",
+			Help:      "Duration of requests to dump viewer API by result (success, error)",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"app", "result"})
+	DumpAgeHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "dumpbeat",
+			Name:      "dump_age_seconds",
+			Help:      "Time from last modification of dump file to its sending",
+			Buckets:   []float64{1, 5, 15, 30, 60, 300, 900, 3600, 21600, 86400, 604800},
+		}, []string{"app"})
+	WatcherEventsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "dumpbeat",
+			Name:      "watcher_events_total",
+			Help:      "Count filesystem events by operation (create, write, remove, rename, close_write)",
+		}, []string{"op"})
 )
 
 // StartExporter ...
 func StartExporter(exporterPort int) error {
 	prometheus.MustRegister(CountUnprocessedFilesGauge)
+	prometheus.MustRegister(CircuitBreakerStateGauge)
+	prometheus.MustRegister(WatchedDirectoriesGauge)
+	prometheus.MustRegister(MaxUserWatchesGauge)
+	prometheus.MustRegister(PendingFilesGauge)
+	prometheus.MustRegister(JobLastRunGauge)
+	prometheus.MustRegister(JobDurationGauge)
+	prometheus.MustRegister(JobLastSuccessGauge)
+	prometheus.MustRegister(JobRunsCounter)
+	prometheus.MustRegister(RetentionReclaimedBytesCounter)
+	prometheus.MustRegister(RetentionDeletedFilesCounter)
+	prometheus.MustRegister(BackupDiskUsageGauge)
+	prometheus.MustRegister(ViewerInstancesGauge)
+	prometheus.MustRegister(DumpsDiscoveredCounter)
+	prometheus.MustRegister(DumpsSentCounter)
+	prometheus.MustRegister(DumpsFailedCounter)
+	prometheus.MustRegister(DumpsMovedCounter)
+	prometheus.MustRegister(DumpsArchivedCounter)
+	prometheus.MustRegister(BytesSentCounter)
+	prometheus.MustRegister(UploadDurationHistogram)
+	prometheus.MustRegister(DumpAgeHistogram)
+	prometheus.MustRegister(WatcherEventsCounter)
 	if exporterPort < 1000 {
 		log.Fatal(fmt.Sprintf("Expected port range 1000-65535. Given %d", exporterPort))
 	}
@@ -35,6 +185,8 @@ func StartExporter(exporterPort int) error {
 	return nil
 }
 
+// CountUnprocessedFilesGaugeHandler count dump files matching pattern file filter every minute.
+// Gauge is -1 when dump directory can't be walked
 func CountUnprocessedFilesGaugeHandler(rootDir string) {
 	for {
 		count := 0.0
@@ -45,13 +197,17 @@ func CountUnprocessedFilesGaugeHandler(rootDir string) {
 			if f.IsDir() {
 				return nil
 			}
-			count += 1
+			if matched, _ := filepath.Match(root.GetConfig().PatternFileFilter, f.Name()); matched {
+				count += 1
+			}
 			return nil
 		})
 		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error count files in %s", err.Error(), rootDir))
 			CountUnprocessedFilesGauge.Set(-1)
+		} else {
+			CountUnprocessedFilesGauge.Set(count)
 		}
-		CountUnprocessedFilesGauge.Set(count)
 		<-time.After(60 * time.Second)
 	}
 }
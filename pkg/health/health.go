@@ -0,0 +1,132 @@
+package health
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/limiter"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Health statuses in terms of consul checks
+const (
+	StatusPassing  = "passing"
+	StatusWarning  = "warning"
+	StatusCritical = "critical"
+)
+
+// Path of health endpoint on exporter port
+const Path = "/health"
+
+var (
+	mux          sync.Mutex
+	started      = time.Now()
+	lastWalk     time.Time
+	lastUpload   time.Time
+	failingSince time.Time
+)
+
+// Report is health status of agent with progress of walker and uploads
+type Report struct {
+	Status       string     `json:"status"`
+	Output       string     `json:"output"`
+	LastWalk     *time.Time `json:"last_walk,omitempty"`
+	LastUpload   *time.Time `json:"last_upload,omitempty"`
+	FailingSince *time.Time `json:"failing_since,omitempty"`
+}
+
+// Walked record completed walk of dump directory
+func Walked() {
+	mux.Lock()
+	defer mux.Unlock()
+	lastWalk = time.Now()
+}
+
+// UploadSucceeded record upload accepted by API
+func UploadSucceeded() {
+	mux.Lock()
+	defer mux.Unlock()
+	lastUpload = time.Now()
+	failingSince = time.Time{}
+}
+
+// UploadFailed record upload failed after all retries. Dumps rejected by API are not upload failures
+func UploadFailed() {
+	mux.Lock()
+	defer mux.Unlock()
+	if failingSince.IsZero() {
+		failingSince = time.Now()
+	}
+}
+
+// Status return health of agent. It is critical when walker didn't complete walk or uploads failed
+// for configured time, warning when API circuit breakers are not closed
+func Status() Report {
+	config := root.GetConfig()
+	mux.Lock()
+	report := Report{Status: StatusPassing, LastWalk: timeOrNil(lastWalk), LastUpload: timeOrNil(lastUpload),
+		FailingSince: timeOrNil(failingSince)}
+	walkRef := lastWalk
+	if walkRef.IsZero() {
+		walkRef = started
+	}
+	mux.Unlock()
+	var problems []string
+	walkTimeout := time.Duration(config.HealthWalkTimeout) * time.Second
+	if walkTimeout > 0 && time.Since(walkRef) > walkTimeout {
+		report.Status = StatusCritical
+		problems = append(problems, fmt.Sprintf("walker made no progress for %s", time.Since(walkRef).Round(time.Second)))
+	}
+	uploadTimeout := time.Duration(config.HealthUploadTimeout) * time.Second
+	if report.FailingSince != nil {
+		failing := time.Since(*report.FailingSince).Round(time.Second)
+		if uploadTimeout > 0 && failing > uploadTimeout {
+			report.Status = StatusCritical
+		} else if report.Status == StatusPassing {
+			report.Status = StatusWarning
+		}
+		problems = append(problems, fmt.Sprintf("uploads failing for %s", failing))
+	}
+	state, output := limiter.Summary()
+	output = strings.Replace(strings.TrimSpace(output), "\n", ", ", -1)
+	if state != limiter.StateClosed {
+		if report.Status == StatusPassing {
+			report.Status = StatusWarning
+		}
+		problems = append(problems, output)
+	}
+	if len(problems) == 0 {
+		report.Output = output
+		return report
+	}
+	report.Output = strings.Join(problems, "; ")
+	return report
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Handler serve health report. Status code is 200 for passing, 429 for warning and 503 for critical
+// as expected by consul HTTP check
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		report := Status()
+		code := http.StatusOK
+		switch report.Status {
+		case StatusWarning:
+			code = http.StatusTooManyRequests
+		case StatusCritical:
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,139 @@
+package kvconfig
+
+import (
+	"dumpbeat/pkg/consul"
+	"dumpbeat/pkg/log"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	commonDir = "common"
+	nodesDir  = "nodes"
+	cacheFile = "config-cache.json"
+)
+
+// Values is configuration from consul KV, setting names are names of command line flags
+type Values map[string]string
+
+// Source reads configuration from consul KV prefix. Keys <prefix>/common/<flag> apply to all nodes,
+// keys <prefix>/nodes/<node>/<flag> override them on one node
+type Source struct {
+	client    consul.Client
+	prefix    string
+	node      string
+	cachePath string
+}
+
+// New create source of configuration under prefix for node. Last applied configuration is cached in data dir
+func New(client consul.Client, prefix, node, dataDir string) *Source {
+	return &Source{
+		client:    client,
+		prefix:    strings.Trim(prefix, "/"),
+		node:      node,
+		cachePath: filepath.Join(dataDir, cacheFile),
+	}
+}
+
+// Load read configuration of node. Non zero wait index makes blocking query which returns when keys change
+func (s *Source) Load(waitIndex uint64) (Values, uint64, error) {
+	pairs, meta, err := s.client.KV(s.prefix+"/", &api.QueryOptions{WaitIndex: waitIndex, WaitTime: 5 * time.Minute})
+	if err != nil {
+		return nil, waitIndex, err
+	}
+	common := Values{}
+	node := Values{}
+	nodePrefix := fmt.Sprintf("%s/%s/%s/", s.prefix, nodesDir, s.node)
+	for _, pair := range pairs {
+		if strings.HasSuffix(pair.Key, "/") {
+			continue
+		}
+		value := strings.TrimSpace(string(pair.Value))
+		if name := strings.TrimPrefix(pair.Key, nodePrefix); name != pair.Key {
+			node[name] = value
+		} else if name := strings.TrimPrefix(pair.Key, s.prefix+"/"+commonDir+"/"); name != pair.Key {
+			common[name] = value
+		}
+	}
+	for name, value := range node {
+		common[name] = value
+	}
+	return common, meta.LastIndex, nil
+}
+
+// ReadCache return last configuration saved by WriteCache
+func (s *Source) ReadCache() (Values, error) {
+	content, err := ioutil.ReadFile(s.cachePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error read config cache %s", s.cachePath)
+	}
+	values := Values{}
+	err = json.Unmarshal(content, &values)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parse config cache %s", s.cachePath)
+	}
+	return values, nil
+}
+
+// WriteCache save configuration to use it when consul is unreachable on start
+func (s *Source) WriteCache(values Values) error {
+	content, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error marshal config cache")
+	}
+	err = os.MkdirAll(filepath.Dir(s.cachePath), os.ModePerm)
+	if err != nil {
+		return errors.Wrapf(err, "Error create dir %s", filepath.Dir(s.cachePath))
+	}
+	tmpPath := filepath.Join(filepath.Dir(s.cachePath), "."+cacheFile+".tmp")
+	err = ioutil.WriteFile(tmpPath, content, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "Error write config cache %s", tmpPath)
+	}
+	err = os.Rename(tmpPath, s.cachePath)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapf(err, "Error rename %s to %s", tmpPath, s.cachePath)
+	}
+	return nil
+}
+
+// Watch wait for changes of configuration with blocking queries and call apply with changed configuration.
+// Configuration accepted by apply is cached, rejected one is skipped until next change
+func (s *Source) Watch(index uint64, current Values, apply func(Values) error) {
+	for {
+		values, newIndex, err := s.Load(index)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error read configuration from consul, retry in 10s", err.Error()))
+			time.Sleep(10 * time.Second)
+			continue
+		}
+		if newIndex < index {
+			// Consul index went backwards (e.g. after restore of consul state), start over
+			newIndex = 0
+		}
+		index = newIndex
+		if reflect.DeepEqual(values, current) {
+			continue
+		}
+		err = apply(values)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Configuration from consul is not applied", err.Error()))
+			current = values
+			continue
+		}
+		current = values
+		err = s.WriteCache(values)
+		if err != nil {
+			log.Error(err.Error())
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package kvconfig
+
+import (
+	"dumpbeat/pkg/consul"
+	"github.com/hashicorp/consul/api"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// kvClient serves keys of KV store, other methods of consul client are not used by source
+type kvClient struct {
+	consul.Client
+	pairs api.KVPairs
+	index uint64
+}
+
+func (c *kvClient) KV(prefix string, _ *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	var pairs api.KVPairs
+	for _, pair := range c.pairs {
+		if strings.HasPrefix(pair.Key, prefix) {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, &api.QueryMeta{LastIndex: c.index}, nil
+}
+
+func TestLoad(t *testing.T) {
+	kv := map[string]string{
+		"dumpbeat/":                           "",
+		"dumpbeat/common/":                    "",
+		"dumpbeat/common/api_url":             "http://viewer:8080",
+		"dumpbeat/common/log_level":           "info",
+		"dumpbeat/common/file_wait_time":      " 30\n",
+		"dumpbeat/nodes/node1/log_level":      "debug",
+		"dumpbeat/nodes/node1/max_file_size":  "20",
+		"dumpbeat/nodes/node10/max_file_size": "50",
+		"dumpbeat/nodes/node2/log_level":      "error",
+		"dumpbeat/other/api_token":            "secret",
+		"dumpbeat-old/common/api_url":         "http://old:8080",
+	}
+	client := &kvClient{index: 42}
+	for key, value := range kv {
+		client.pairs = append(client.pairs, &api.KVPair{Key: key, Value: []byte(value)})
+	}
+	tests := []struct {
+		prefix string
+		node   string
+		values Values
+	}{
+		{"dumpbeat", "node1", Values{
+			"api_url":        "http://viewer:8080",
+			"log_level":      "debug",
+			"file_wait_time": "30",
+			"max_file_size":  "20",
+		}},
+		{"/dumpbeat/", "node2", Values{
+			"api_url":        "http://viewer:8080",
+			"log_level":      "error",
+			"file_wait_time": "30",
+		}},
+		{"dumpbeat", "node3", Values{
+			"api_url":        "http://viewer:8080",
+			"log_level":      "info",
+			"file_wait_time": "30",
+		}},
+		{"missing", "node1", Values{}},
+	}
+	for _, test := range tests {
+		values, index, err := New(client, test.prefix, test.node, "").Load(0)
+		if err != nil {
+			t.Errorf("Load(%s, %s) returned error %v", test.prefix, test.node, err)
+			continue
+		}
+		if index != 42 {
+			t.Errorf("Load(%s, %s) returned index %d, expected 42", test.prefix, test.node, index)
+		}
+		if !reflect.DeepEqual(values, test.values) {
+			t.Errorf("Load(%s, %s) = %v, expected %v", test.prefix, test.node, values, test.values)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "kvconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	source := New(&kvClient{}, "dumpbeat", "node1", dataDir)
+	if _, err = source.ReadCache(); err == nil {
+		t.Error("ReadCache without cache expected error")
+	}
+	values := Values{"api_url": "http://viewer:8080", "log_level": "debug"}
+	if err = source.WriteCache(values); err != nil {
+		t.Fatalf("WriteCache returned error %v", err)
+	}
+	cached, err := source.ReadCache()
+	if err != nil {
+		t.Fatalf("ReadCache returned error %v", err)
+	}
+	if !reflect.DeepEqual(cached, values) {
+		t.Errorf("ReadCache = %v, expected %v", cached, values)
+	}
+}
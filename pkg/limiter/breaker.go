@@ -0,0 +1,131 @@
+package limiter
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State of circuit breaker
+type State int
+
+const (
+	// StateClosed requests are allowed
+	StateClosed State = iota
+	// StateHalfOpen limited probe requests are allowed
+	StateHalfOpen
+	// StateOpen requests are rejected
+	StateOpen
+)
+
+// ErrCircuitOpen is returned when requests to endpoint are paused
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+func (s State) String() string {
+	switch s {
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker pause requests after consecutive failures
+type CircuitBreaker struct {
+	maxFailures   int
+	openTime      time.Duration
+	maxProbes     int
+	state         State
+	failures      int
+	probes        int
+	openedAt      time.Time
+	onStateChange func(State)
+	mux           sync.Mutex
+}
+
+// NewCircuitBreaker create breaker which opens after maxFailures consecutive failures
+// for openTime and then allows maxProbes requests in half-open state. Zero maxFailures disables breaker
+func NewCircuitBreaker(maxFailures int, openTime time.Duration, maxProbes int, onStateChange func(State)) *CircuitBreaker {
+	if maxProbes < 1 {
+		maxProbes = 1
+	}
+	return &CircuitBreaker{
+		maxFailures:   maxFailures,
+		openTime:      openTime,
+		maxProbes:     maxProbes,
+		onStateChange: onStateChange,
+	}
+}
+
+// Allow check that request can be sent. Every allowed request must be finished by Success or Failure
+func (cb *CircuitBreaker) Allow() error {
+	if cb == nil || cb.maxFailures <= 0 {
+		return nil
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	if cb.state == StateOpen {
+		if time.Since(cb.openedAt) < cb.openTime {
+			return ErrCircuitOpen
+		}
+		cb.setState(StateHalfOpen)
+	}
+	if cb.state == StateHalfOpen {
+		if cb.probes >= cb.maxProbes {
+			return ErrCircuitOpen
+		}
+		cb.probes++
+	}
+	return nil
+}
+
+// Success close breaker
+func (cb *CircuitBreaker) Success() {
+	if cb == nil || cb.maxFailures <= 0 {
+		return
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.failures = 0
+	cb.setState(StateClosed)
+}
+
+// Failure count failure and open breaker when threshold is reached or probe failed
+func (cb *CircuitBreaker) Failure() {
+	if cb == nil || cb.maxFailures <= 0 {
+		return
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.failures++
+	if cb.state == StateHalfOpen || cb.failures >= cb.maxFailures {
+		cb.openedAt = time.Now()
+		cb.setState(StateOpen)
+	}
+}
+
+// State return current state of breaker
+func (cb *CircuitBreaker) State() State {
+	if cb == nil {
+		return StateClosed
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	if cb.state == StateOpen && time.Since(cb.openedAt) >= cb.openTime {
+		return StateHalfOpen
+	}
+	return cb.state
+}
+
+func (cb *CircuitBreaker) setState(state State) {
+	cb.probes = 0
+	if cb.state == state {
+		return
+	}
+	cb.state = state
+	if cb.onStateChange != nil {
+		cb.onStateChange(state)
+	}
+}
@@ -0,0 +1,102 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+const testOpenTime = 50 * time.Millisecond
+
+type breakerStep struct {
+	action string
+	err    error
+	state  State
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []breakerStep
+	}{
+		{"opens after max failures", []breakerStep{
+			{"allow", nil, StateClosed},
+			{"failure", nil, StateClosed},
+			{"allow", nil, StateClosed},
+			{"failure", nil, StateOpen},
+			{"allow", ErrCircuitOpen, StateOpen},
+		}},
+		{"success resets failures", []breakerStep{
+			{"failure", nil, StateClosed},
+			{"success", nil, StateClosed},
+			{"failure", nil, StateClosed},
+			{"allow", nil, StateClosed},
+		}},
+		{"half open limits probes", []breakerStep{
+			{"failure", nil, StateClosed},
+			{"failure", nil, StateOpen},
+			{"wait", nil, StateHalfOpen},
+			{"allow", nil, StateHalfOpen},
+			{"allow", ErrCircuitOpen, StateHalfOpen},
+		}},
+		{"successful probe closes", []breakerStep{
+			{"failure", nil, StateClosed},
+			{"failure", nil, StateOpen},
+			{"wait", nil, StateHalfOpen},
+			{"allow", nil, StateHalfOpen},
+			{"success", nil, StateClosed},
+			{"allow", nil, StateClosed},
+		}},
+		{"failed probe opens again", []breakerStep{
+			{"failure", nil, StateClosed},
+			{"failure", nil, StateOpen},
+			{"wait", nil, StateHalfOpen},
+			{"allow", nil, StateHalfOpen},
+			{"failure", nil, StateOpen},
+			{"allow", ErrCircuitOpen, StateOpen},
+		}},
+	}
+	for _, test := range tests {
+		var changes []State
+		cb := NewCircuitBreaker(2, testOpenTime, 1, func(state State) {
+			changes = append(changes, state)
+		})
+		for i, step := range test.steps {
+			var err error
+			switch step.action {
+			case "allow":
+				err = cb.Allow()
+			case "success":
+				cb.Success()
+			case "failure":
+				cb.Failure()
+			case "wait":
+				time.Sleep(testOpenTime)
+			}
+			if err != step.err {
+				t.Errorf("%s: step %d %s returned %v, expected %v", test.name, i, step.action, err, step.err)
+			}
+			if state := cb.State(); state != step.state {
+				t.Errorf("%s: state after step %d %s is %s, expected %s", test.name, i, step.action, state, step.state)
+			}
+		}
+		for i := 1; i < len(changes); i++ {
+			if changes[i] == changes[i-1] {
+				t.Errorf("%s: state change to %s reported twice", test.name, changes[i])
+			}
+		}
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	for _, cb := range []*CircuitBreaker{nil, NewCircuitBreaker(0, testOpenTime, 1, nil)} {
+		for i := 0; i < 5; i++ {
+			cb.Failure()
+		}
+		if err := cb.Allow(); err != nil {
+			t.Errorf("disabled breaker Allow() returned %v", err)
+		}
+		if state := cb.State(); state != StateClosed {
+			t.Errorf("disabled breaker state is %s", state)
+		}
+	}
+}
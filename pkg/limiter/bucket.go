@@ -0,0 +1,66 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket limits rate of events. Zero rate means unlimited
+type TokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	mux      sync.Mutex
+}
+
+// NewTokenBucket create bucket with rate tokens per second and burst capacity
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	capacity := float64(burst)
+	if capacity < rate {
+		capacity = rate
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &TokenBucket{
+		rate:     rate,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+// Wait block until n tokens are available and take them. Requests bigger than
+// bucket capacity wait for full bucket and leave it in debt
+func (b *TokenBucket) Wait(n int) {
+	delay := b.Reserve(n)
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// Reserve take n tokens and return time to wait before using them
+func (b *TokenBucket) Reserve(n int) time.Duration {
+	if b == nil || b.rate <= 0 {
+		return 0
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+	need := float64(n)
+	if need > b.capacity {
+		need = b.capacity
+	}
+	var delay time.Duration
+	if b.tokens < need {
+		delay = time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+	}
+	b.tokens -= float64(n)
+	return delay
+}
@@ -0,0 +1,91 @@
+package limiter
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/exporter"
+	"dumpbeat/pkg/log"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Endpoint holds rate limits and circuit breaker of one API server
+type Endpoint struct {
+	Name     string
+	Requests *TokenBucket
+	Bytes    *TokenBucket
+	Breaker  *CircuitBreaker
+}
+
+var (
+	endpoints = make(map[string]*Endpoint)
+	mux       sync.Mutex
+)
+
+// ForURL return endpoint limiter for scheme and host of API url
+func ForURL(apiURL string) *Endpoint {
+	name := apiURL
+	if u, err := url.Parse(apiURL); err == nil && u.Host != "" {
+		name = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	if endpoint, ok := endpoints[name]; ok {
+		return endpoint
+	}
+	config := root.GetConfig()
+	endpoint := &Endpoint{
+		Name:     name,
+		Requests: NewTokenBucket(config.APIRateLimit, config.APIRateBurst),
+		Bytes:    NewTokenBucket(float64(config.APIBytesRateLimit), config.APIBytesRateLimit),
+		Breaker: NewCircuitBreaker(config.CircuitBreakerFailures, time.Duration(config.CircuitBreakerOpenTime)*time.Second,
+			config.CircuitBreakerProbes, func(state State) {
+				log.Info(fmt.Sprintf("Circuit breaker for %s changed state to %s", name, state))
+				exporter.CircuitBreakerStateGauge.WithLabelValues(name).Set(float64(state))
+			}),
+	}
+	exporter.CircuitBreakerStateGauge.WithLabelValues(name).Set(float64(StateClosed))
+	endpoints[name] = endpoint
+	return endpoint
+}
+
+// Wait for rate limits before send request with size bytes body
+func (e *Endpoint) Wait(size int) {
+	e.Requests.Wait(1)
+	e.Bytes.Wait(size)
+}
+
+// States return circuit breaker states of all known endpoints
+func States() map[string]State {
+	mux.Lock()
+	defer mux.Unlock()
+	states := make(map[string]State, len(endpoints))
+	for name, endpoint := range endpoints {
+		states[name] = endpoint.Breaker.State()
+	}
+	return states
+}
+
+// Summary return worst circuit breaker state and human readable description
+func Summary() (State, string) {
+	states := States()
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	worst := StateClosed
+	output := ""
+	for _, name := range names {
+		if states[name] > worst {
+			worst = states[name]
+		}
+		output += fmt.Sprintf("%s: %s\n", name, states[name])
+	}
+	if output == "" {
+		output = "No uploads yet"
+	}
+	return worst, output
+}
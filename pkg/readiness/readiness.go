@@ -0,0 +1,204 @@
+package readiness
+
+import (
+	root "dumpbeat/pkg"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// StrategyQuiet file is ready after quiet period without writes
+	StrategyQuiet = "quiet"
+	// StrategyCloseWrite file is ready after writer closed it (inotify IN_CLOSE_WRITE)
+	StrategyCloseWrite = "close_write"
+	// StrategyStable file is ready when size and modification time are the same across several polls
+	StrategyStable = "stable"
+	// StrategyMarker file is ready when marker file (e.g. foo.txt.done) exists
+	StrategyMarker = "marker"
+	// StrategyRename file is ready as soon as it appears, writer renames complete file into place
+	StrategyRename = "rename"
+)
+
+// Checker decides whether dump file is completely written
+type Checker interface {
+	// Ready report whether file can be sent. lastEvent is time of last filesystem event
+	// for the file or zero time when file was found by walker
+	Ready(fileName string, fileInfo os.FileInfo, lastEvent time.Time) bool
+	// Deadline return time when watched file should be checked after event at lastEvent
+	Deadline(fileName string, lastEvent time.Time) time.Time
+}
+
+type quiet struct{}
+
+func (quiet) Ready(_ string, fileInfo os.FileInfo, lastEvent time.Time) bool {
+	config := root.GetConfig()
+	if lastEvent.IsZero() {
+		return int(time.Since(fileInfo.ModTime()).Seconds()) >= config.FileWaitTime
+	}
+	return time.Since(lastEvent) >= time.Duration(config.ReadinessQuietPeriod)*time.Second
+}
+
+func (quiet) Deadline(_ string, lastEvent time.Time) time.Time {
+	return lastEvent.Add(time.Duration(root.GetConfig().ReadinessQuietPeriod) * time.Second)
+}
+
+type closeWrite struct{}
+
+func (closeWrite) Ready(fileName string, fileInfo os.FileInfo, lastEvent time.Time) bool {
+	if lastEvent.IsZero() {
+		// Close event could be missed, walker falls back to file wait time
+		return quiet{}.Ready(fileName, fileInfo, lastEvent)
+	}
+	if time.Since(lastEvent) >= time.Duration(root.GetConfig().FileWaitTime)*time.Second {
+		return true
+	}
+	// Close and write events come from different queues, so closing is compared with modification time
+	closedAt, ok := closedTime(fileName)
+	return ok && !closedAt.Before(fileInfo.ModTime())
+}
+
+func (closeWrite) Deadline(fileName string, lastEvent time.Time) time.Time {
+	if closedAt, ok := closedTime(fileName); ok {
+		if !closedAt.Before(lastEvent) {
+			return lastEvent
+		}
+		// Write event may be delivered after close event
+		return lastEvent.Add(time.Duration(root.GetConfig().ReadinessQuietPeriod) * time.Second)
+	}
+	// Wait for close event, file wait time is used if it is missed
+	return lastEvent.Add(time.Duration(root.GetConfig().FileWaitTime) * time.Second)
+}
+
+func closedTime(fileName string) (time.Time, bool) {
+	closedMux.Lock()
+	defer closedMux.Unlock()
+	closedAt, ok := closed[fileName]
+	return closedAt, ok
+}
+
+type stable struct{}
+
+type pollState struct {
+	size     int64
+	modTime  time.Time
+	polls    int
+	lastPoll time.Time
+}
+
+func (stable) Ready(fileName string, fileInfo os.FileInfo, _ time.Time) bool {
+	config := root.GetConfig()
+	pollsMux.Lock()
+	defer pollsMux.Unlock()
+	state, ok := polls[fileName]
+	if !ok || state.size != fileInfo.Size() || !state.modTime.Equal(fileInfo.ModTime()) {
+		polls[fileName] = &pollState{size: fileInfo.Size(), modTime: fileInfo.ModTime(), polls: 1, lastPoll: time.Now()}
+		return config.ReadinessStablePolls <= 1
+	}
+	if time.Since(state.lastPoll) >= time.Duration(config.ReadinessStableInterval)*time.Second {
+		state.polls++
+		state.lastPoll = time.Now()
+	}
+	return state.polls >= config.ReadinessStablePolls
+}
+
+func (stable) Deadline(_ string, lastEvent time.Time) time.Time {
+	return lastEvent.Add(time.Duration(root.GetConfig().ReadinessStableInterval) * time.Second)
+}
+
+type marker struct{}
+
+func (marker) Ready(fileName string, _ os.FileInfo, _ time.Time) bool {
+	_, err := os.Stat(MarkerFile(fileName))
+	return err == nil
+}
+
+func (marker) Deadline(fileName string, lastEvent time.Time) time.Time {
+	if _, err := os.Stat(MarkerFile(fileName)); err == nil {
+		return lastEvent
+	}
+	return lastEvent.Add(time.Duration(root.GetConfig().ReadinessQuietPeriod) * time.Second)
+}
+
+type rename struct{}
+
+func (rename) Ready(string, os.FileInfo, time.Time) bool {
+	return true
+}
+
+func (rename) Deadline(_ string, lastEvent time.Time) time.Time {
+	return lastEvent
+}
+
+var (
+	closed    = make(map[string]time.Time)
+	closedMux sync.Mutex
+	polls     = make(map[string]*pollState)
+	pollsMux  sync.Mutex
+)
+
+// For return readiness checker configured for app of dump file
+func For(fileName string) Checker {
+	switch Strategy(fileName) {
+	case StrategyCloseWrite:
+		return closeWrite{}
+	case StrategyStable:
+		return stable{}
+	case StrategyMarker:
+		return marker{}
+	case StrategyRename:
+		return rename{}
+	default:
+		return quiet{}
+	}
+}
+
+// Strategy return readiness strategy name for app of dump file
+func Strategy(fileName string) string {
+	config := root.GetConfig()
+	sep := string(os.PathSeparator)
+	appName := strings.Split(strings.TrimLeft(strings.Replace(fileName, config.DumpDir, "", 1), sep), sep)[0]
+	if strategy, ok := config.ReadinessMap[appName]; ok {
+		return strategy
+	}
+	return config.ReadinessStrategy
+}
+
+// Uses report whether strategy is configured by default or for any app
+func Uses(strategy string) bool {
+	config := root.GetConfig()
+	if config.ReadinessStrategy == strategy {
+		return true
+	}
+	for _, appStrategy := range config.ReadinessMap {
+		if appStrategy == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkClosed remember that file was closed after write and return time of event
+func MarkClosed(fileName string) time.Time {
+	closedMux.Lock()
+	defer closedMux.Unlock()
+	now := time.Now()
+	closed[fileName] = now
+	return now
+}
+
+// MarkerFile return name of marker file for dump file
+func MarkerFile(fileName string) string {
+	return fileName + root.GetConfig().ReadinessMarkerSuffix
+}
+
+// Forget drop readiness state of processed or removed file
+func Forget(fileName string) {
+	closedMux.Lock()
+	delete(closed, fileName)
+	closedMux.Unlock()
+	pollsMux.Lock()
+	delete(polls, fileName)
+	pollsMux.Unlock()
+}
@@ -1,29 +1,125 @@
 package root
 
+import "sync/atomic"
+
 // Config ...
 type Config struct {
-	DumpDir             string
-	BackupDir           string
-	PatternFileFilter   string
-	FileWaitTime        int
-	APIUrl              string
-	APIToken            string
-	DaysToArchive       int
-	NodeName            string
-	MaxFileSize         int
-	SentryDSN           string
-	Aliases             string
-	ConsulHost          string
-	ConsulServiceName   string
-	ExporterBindAddress string
-	ExporterBindPort    int
-	LogLevel            string
-	AliasesMap          map[string]string
+	DumpDir                       string
+	BackupDir                     string
+	PatternFileFilter             string
+	FileWaitTime                  int
+	APIUrl                        string
+	APIToken                      string
+	DaysToArchive                 int
+	NodeName                      string
+	MaxFileSize                   int
+	SentryDSN                     string
+	Aliases                       string
+	ConsulHost                    string
+	ConsulServiceName             string
+	ExporterBindAddress           string
+	ExporterBindPort              int
+	LogLevel                      string
+	APIConnectTimeout             int
+	APIResponseTimeout            int
+	APITimeout                    int
+	APIKeepAlive                  int
+	APIProxy                      string
+	APINoProxy                    string
+	APIMaxIdleConns               int
+	APIMaxIdleConnsPerHost        int
+	APIMaxConnsPerHost            int
+	APIIdleConnTimeout            int
+	APISuccessCodes               string
+	APIMaxRetries                 int
+	APIRetryBackoff               int
+	APIMaxRetryAfter              int
+	APIRateLimit                  float64
+	APIRateBurst                  int
+	APIBytesRateLimit             int
+	CircuitBreakerFailures        int
+	CircuitBreakerOpenTime        int
+	CircuitBreakerProbes          int
+	BatchEnabled                  bool
+	BatchMaxCount                 int
+	BatchMaxBytes                 int
+	BatchMaxWait                  int
+	BatchFormat                   string
+	BatchEndpoint                 string
+	DataDir                       string
+	AckRetention                  int
+	ReadinessStrategy             string
+	ReadinessOverrides            string
+	ReadinessQuietPeriod          int
+	ReadinessStablePolls          int
+	ReadinessStableInterval       int
+	ReadinessMarkerSuffix         string
+	ReadinessMap                  map[string]string
+	WatcherBackend                string
+	WatcherPollInterval           int
+	PendingFilesLimit             int
+	RegistryFlushInterval         int
+	RegistryCompactInterval       int
+	TailPattern                   string
+	TailDelimiter                 string
+	TailMultilineStart            string
+	TailRecordTimeout             int
+	Splitter                      string
+	SplitterOverrides             string
+	SplitterStart                 string
+	SplitterEnd                   string
+	SplitterMap                   map[string]string
+	WalkSchedule                  string
+	CleanupSchedule               string
+	ArchiveSchedule               string
+	JobJitter                     int
+	AdminToken                    string
+	ArchiveMaxAge                 int
+	ArchiveMaxSize                int
+	ArchiveMaxCount               int
+	BackupMaxAge                  int
+	BackupMaxSize                 int
+	BackupMaxCount                int
+	DiskHighWatermark             float64
+	DiskLowWatermark              float64
+	DiskWatermarkMinArchives      int
+	RetentionSchedule             string
+	ArchiveFormat                 string
+	ArchiveCompressionLevel       int
+	ArchiveMemberNames            string
+	ArchiveGrouping               string
+	ServiceDiscovery              string
+	FileSDPath                    string
+	EtcdEndpoints                 string
+	EtcdPrefix                    string
+	EtcdTTL                       int
+	HealthWalkTimeout             int
+	HealthUploadTimeout           int
+	HealthCheckInterval           string
+	ConsulServiceID               string
+	ConsulServiceTags             string
+	ConsulServiceMeta             string
+	ConsulDeregisterCriticalAfter string
+	ConsulServiceMetaMap          map[string]string
+	APIConsulService              string
+	APIConsulTag                  string
+	ConfigConsulPrefix            string
+	AliasesMap                    map[string]string
 }
 
-var config Config
+// config holds *Config. Configuration is replaced as a whole on reload, so readers never see it half written
+var config atomic.Value
+
+func init() {
+	config.Store(&Config{})
+}
 
-// GetConfig ...
+// GetConfig return current configuration. It must not be changed, new configuration is published by SetConfig
 func GetConfig() *Config {
-	return &config
+	return config.Load().(*Config)
+}
+
+// SetConfig publish new configuration. Readers holding previous one keep consistent copy
+func SetConfig(c *Config) {
+	config.Store(c)
 }
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AdminPath is prefix of scheduler admin endpoints
+const AdminPath = "/admin/jobs"
+
+// Handler serve jobs list on GET /admin/jobs and run job on POST /admin/jobs/{name}/run.
+// Requests must have header `Authorization: Bearer {token}`, with empty token admin endpoints are disabled
+func (s *Scheduler) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "admin endpoints are disabled, admin token is not set", http.StatusForbidden)
+			return
+		}
+		expected := []byte(fmt.Sprintf("Bearer %s", token))
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		name := strings.Trim(strings.TrimPrefix(r.URL.Path, AdminPath), "/")
+		if name == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(s.Statuses())
+			return
+		}
+		if !strings.HasSuffix(name, "/run") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		switch err := s.Trigger(strings.TrimSuffix(name, "/run")); err {
+		case nil:
+			w.WriteHeader(http.StatusAccepted)
+		case ErrUnknownJob:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package scheduler
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule return next activation time after given time
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// Interval runs job with fixed delay after previous run
+type Interval time.Duration
+
+// Next return time after interval
+func (i Interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// Cron is standard five fields cron expression: minute hour day-of-month month day-of-week
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse schedule specification. Supported formats are seconds (`120`), duration (`2m`, `@every 2m`),
+// cron expression (`*/5 * * * *`) and descriptors (`@hourly`, `@daily`, ...)
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("empty schedule")
+	}
+	if seconds, err := strconv.Atoi(spec); err == nil {
+		if seconds <= 0 {
+			return nil, errors.Errorf("schedule interval must be positive, given %s", spec)
+		}
+		return Interval(time.Duration(seconds) * time.Second), nil
+	}
+	if strings.HasPrefix(spec, "@every ") {
+		spec = strings.TrimSpace(strings.TrimPrefix(spec, "@every "))
+	}
+	if duration, err := time.ParseDuration(spec); err == nil {
+		if duration <= 0 {
+			return nil, errors.Errorf("schedule interval must be positive, given %s", spec)
+		}
+		return Interval(duration), nil
+	}
+	if expression, ok := descriptors[spec]; ok {
+		spec = expression
+	}
+	return parseCron(spec)
+}
+
+func parseCron(spec string) (*Cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("expected 5 fields in cron expression %s", spec)
+	}
+	c := &Cron{}
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, errors.Wrapf(err, "Error parse minute of %s", spec)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, errors.Wrapf(err, "Error parse hour of %s", spec)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, errors.Wrapf(err, "Error parse day of month of %s", spec)
+	}
+	if c.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, errors.Wrapf(err, "Error parse month of %s", spec)
+	}
+	if c.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, errors.Wrapf(err, "Error parse day of week of %s", spec)
+	}
+	// Sunday may be written as 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = strings.HasPrefix(fields[2], "*")
+	c.dowStar = strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// parseField parse comma separated list of values, ranges and steps into bit set
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid step %s", part)
+			}
+			part = part[:i]
+		}
+		low, high := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.Errorf("invalid range %s", part)
+			}
+			if high, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, errors.Errorf("invalid range %s", part)
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, errors.Errorf("invalid value %s", part)
+			}
+			low = value
+			if step == 1 {
+				high = value
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, errors.Errorf("value %s out of range %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// Next return first time matching expression after given time
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	// Expression like `0 0 30 2 *` never matches, give up after 5 years
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches check day of month and day of week. When both are restricted either of them should match
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
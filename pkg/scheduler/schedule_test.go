@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// Tuesday
+	from := time.Date(2026, 3, 10, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"120", time.Date(2026, 3, 10, 10, 9, 30, 0, time.UTC)},
+		{" 2m ", time.Date(2026, 3, 10, 10, 9, 30, 0, time.UTC)},
+		{"@every 90s", time.Date(2026, 3, 10, 10, 9, 0, 0, time.UTC)},
+		{"*/5 * * * *", time.Date(2026, 3, 10, 10, 10, 0, 0, time.UTC)},
+		{"7 * * * *", time.Date(2026, 3, 10, 11, 7, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 3, 10, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2026, 3, 11, 9, 30, 0, 0, time.UTC)},
+		{"0 8,20 * * *", time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted
+		{"0 0 20 * 4", time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error %v", test.spec, err)
+			continue
+		}
+		if next := schedule.Next(from); !next.Equal(test.next) {
+			t.Errorf("Parse(%q).Next() = %v, expected %v", test.spec, next, test.next)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"0",
+		"-5",
+		"-1m",
+		"@every 0s",
+		"@sometimes",
+		"* * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) expected error", spec)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"dumpbeat/pkg/exporter"
+	"dumpbeat/pkg/log"
+	"fmt"
+	"github.com/pkg/errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownJob is returned on trigger of not registered job
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrJobRunning is returned on trigger of job which is already running or triggered
+	ErrJobRunning = errors.New("job is already running")
+)
+
+// Job is periodic task of agent
+type Job struct {
+	Name     string
+	Schedule Schedule
+	// Jitter is maximum random delay added to every scheduled run
+	Jitter time.Duration
+	Run    func() error
+	// Lock is shared by jobs which must not run concurrently, nil for independent job
+	Lock sync.Locker
+
+	trigger  chan struct{}
+	mux      sync.Mutex
+	running  bool
+	status   Status
+	nextTime time.Time
+}
+
+// Status of job last run
+type Status struct {
+	Name         string    `json:"name"`
+	Running      bool      `json:"running"`
+	LastRun      time.Time `json:"last_run"`
+	LastDuration string    `json:"last_duration"`
+	LastError    string    `json:"last_error,omitempty"`
+	Failures     int       `json:"consecutive_failures"`
+	Skipped      int       `json:"skipped"`
+	NextRun      time.Time `json:"next_run"`
+}
+
+// Scheduler runs registered jobs independently of each other
+type Scheduler struct {
+	jobs map[string]*Job
+	mux  sync.Mutex
+}
+
+// New create empty scheduler
+func New() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*Job)}
+}
+
+// Add register job. Jobs with interval schedule run at start, cron jobs wait for first matching time
+func (s *Scheduler) Add(job *Job) {
+	job.trigger = make(chan struct{}, 1)
+	job.status.Name = job.Name
+	s.mux.Lock()
+	s.jobs[job.Name] = job
+	s.mux.Unlock()
+}
+
+// Start run loops of all registered jobs
+func (s *Scheduler) Start() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, job := range s.jobs {
+		go job.loop()
+	}
+}
+
+// Trigger run job as soon as possible without waiting for schedule
+func (s *Scheduler) Trigger(name string) error {
+	s.mux.Lock()
+	job, ok := s.jobs[name]
+	s.mux.Unlock()
+	if !ok {
+		return ErrUnknownJob
+	}
+	job.mux.Lock()
+	defer job.mux.Unlock()
+	if !job.running {
+		select {
+		case job.trigger <- struct{}{}:
+			return nil
+		default:
+		}
+	}
+	job.status.Skipped++
+	exporter.JobRunsCounter.WithLabelValues(job.Name, "skipped").Inc()
+	return ErrJobRunning
+}
+
+// Statuses return state of all jobs sorted by name
+func (s *Scheduler) Statuses() []Status {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var statuses []Status
+	for _, job := range s.jobs {
+		job.mux.Lock()
+		status := job.status
+		status.Running = job.running
+		status.NextRun = job.nextTime
+		job.mux.Unlock()
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+func (job *Job) loop() {
+	next := time.Now()
+	if _, ok := job.Schedule.(Interval); !ok {
+		next = job.next(next)
+	}
+	for {
+		job.mux.Lock()
+		job.nextTime = next
+		job.mux.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-job.trigger:
+			timer.Stop()
+			log.Info(fmt.Sprintf("Job %s triggered", job.Name))
+		}
+		job.run()
+		next = job.next(time.Now())
+		select {
+		case <-job.trigger:
+			// Trigger received during run is satisfied by this run
+		default:
+		}
+	}
+}
+
+// next return time of next scheduled run with jitter. Runs never overlap: activations missed
+// while job was running are skipped
+func (job *Job) next(from time.Time) time.Time {
+	next := job.Schedule.Next(from)
+	if next.IsZero() {
+		log.Error(fmt.Sprintf("Schedule of job %s has no next run time", job.Name))
+		next = from.Add(24 * time.Hour)
+	}
+	if job.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(job.Jitter))))
+	}
+	return next
+}
+
+// run execute job once. Errors and panics are logged and counted, they don't stop agent
+func (job *Job) run() {
+	job.mux.Lock()
+	job.running = true
+	job.mux.Unlock()
+
+	if job.Lock != nil {
+		job.Lock.Lock()
+	}
+	start := time.Now()
+	err := job.safeRun()
+	duration := time.Since(start)
+	if job.Lock != nil {
+		job.Lock.Unlock()
+	}
+
+	job.mux.Lock()
+	job.running = false
+	job.status.LastRun = start
+	job.status.LastDuration = duration.String()
+	job.status.LastError = ""
+	if err != nil {
+		job.status.LastError = err.Error()
+		job.status.Failures++
+	} else {
+		job.status.Failures = 0
+	}
+	failures := job.status.Failures
+	job.mux.Unlock()
+
+	exporter.JobLastRunGauge.WithLabelValues(job.Name).Set(float64(start.Unix()))
+	exporter.JobDurationGauge.WithLabelValues(job.Name).Set(duration.Seconds())
+	if err != nil {
+		exporter.JobRunsCounter.WithLabelValues(job.Name, "error").Inc()
+		exporter.JobLastSuccessGauge.WithLabelValues(job.Name).Set(0)
+		log.Error(fmt.Sprintf("%s. Job %s failed (%d times in a row)", err.Error(), job.Name, failures))
+		return
+	}
+	exporter.JobRunsCounter.WithLabelValues(job.Name, "success").Inc()
+	exporter.JobLastSuccessGauge.WithLabelValues(job.Name).Set(1)
+	log.Debug(fmt.Sprintf("Job %s finished in %s", job.Name, duration))
+}
+
+func (job *Job) safeRun() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run()
+}
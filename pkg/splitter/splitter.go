@@ -0,0 +1,119 @@
+package splitter
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+const (
+	// PresetJava splits jstack output and Java thread dumps (SIGQUIT)
+	PresetJava = "java"
+	// PresetGo splits Go panics and goroutine dumps
+	PresetGo = "go"
+	// PresetPython splits Python tracebacks
+	PresetPython = "python"
+	// PresetCustom uses configured start and end patterns
+	PresetCustom = "custom"
+)
+
+// presets contain start and end patterns of well known dump formats
+var presets = map[string][2]string{
+	PresetJava:   {`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$|Full thread dump )`, ``},
+	PresetGo:     {`^(panic: |fatal error: |SIGQUIT: |goroutine 1 \[running\])`, ``},
+	PresetPython: {`^Traceback \(most recent call last\):`, ``},
+}
+
+// Record is one dump found in file content
+type Record struct {
+	Index   int
+	Offset  int64
+	Length  int64
+	Content []byte
+}
+
+// Splitter splits content with several concatenated dumps into records. Record begins with line
+// matched by start pattern and ends before next start line or after line matched by end pattern.
+// Start lines following each other (blank lines between them are allowed) open one record, so
+// header like `panic: ...` and `goroutine 1 [running]:` are kept together
+type Splitter struct {
+	start *regexp.Regexp
+	end   *regexp.Regexp
+}
+
+// New create splitter from start and end regular expressions. End pattern is optional
+func New(start, end string) (*Splitter, error) {
+	s := &Splitter{}
+	var err error
+	s.start, err = regexp.Compile(start)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error compile start pattern %s", start)
+	}
+	if end != "" {
+		s.end, err = regexp.Compile(end)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error compile end pattern %s", end)
+		}
+	}
+	return s, nil
+}
+
+// NewPreset create splitter by preset name. Custom preset uses given start and end patterns
+func NewPreset(name, start, end string) (*Splitter, error) {
+	if name == PresetCustom {
+		return New(start, end)
+	}
+	patterns, ok := presets[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.Errorf("unknown splitter preset %s", name)
+	}
+	return New(patterns[0], patterns[1])
+}
+
+// Split return records of data starting at offset. Last record is returned only when final is set,
+// because it may be continued. Text outside of records is returned as separate record unless it is blank
+func (s *Splitter) Split(data []byte, offset int64, final bool) []Record {
+	var records []Record
+	add := func(begin, end int) {
+		if len(bytes.TrimSpace(data[begin:end])) == 0 {
+			return
+		}
+		records = append(records, Record{
+			Index:   len(records),
+			Offset:  offset + int64(begin),
+			Length:  int64(end - begin),
+			Content: data[begin:end],
+		})
+	}
+	begin := 0
+	inHeader := false
+	for position := 0; position < len(data); {
+		lineEnd := bytes.IndexByte(data[position:], '\n')
+		if lineEnd < 0 {
+			break
+		}
+		line := data[position : position+lineEnd]
+		next := position + lineEnd + 1
+		switch {
+		case s.start.Match(line):
+			if !inHeader && position > begin {
+				add(begin, position)
+				begin = position
+			}
+			inHeader = true
+		case len(bytes.TrimSpace(line)) == 0:
+		default:
+			inHeader = false
+			if s.end != nil && s.end.Match(line) {
+				add(begin, next)
+				begin = next
+			}
+		}
+		position = next
+	}
+	if final && begin < len(data) {
+		add(begin, len(data))
+	}
+	return records
+}
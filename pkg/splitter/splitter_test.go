@@ -0,0 +1,136 @@
+package splitter
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	goPanic = "panic: runtime error: index out of range\n\ngoroutine 1 [running]:\nmain.main()\n\t/app/main.go:5 +0x1d\n"
+	goFatal = "fatal error: all goroutines are asleep - deadlock!\n\ngoroutine 1 [chan receive]:\nmain.main()\n"
+	pyTrace = "Traceback (most recent call last):\n  File \"app.py\", line 1, in <module>\nZeroDivisionError: division by zero\n"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		preset  string
+		start   string
+		end     string
+		data    string
+		offset  int64
+		final   bool
+		records []string
+		offsets []int64
+	}{
+		{
+			name:    "go panic header kept together",
+			preset:  PresetGo,
+			data:    goPanic,
+			final:   true,
+			records: []string{goPanic},
+			offsets: []int64{0},
+		},
+		{
+			name:    "go two dumps",
+			preset:  PresetGo,
+			data:    goPanic + goFatal,
+			offset:  100,
+			final:   true,
+			records: []string{goPanic, goFatal},
+			offsets: []int64{100, 100 + int64(len(goPanic))},
+		},
+		{
+			name:    "last record waits for final",
+			preset:  PresetGo,
+			data:    goPanic + goFatal,
+			records: []string{goPanic},
+			offsets: []int64{0},
+		},
+		{
+			name:    "text before first dump",
+			preset:  PresetPython,
+			data:    "starting worker\n" + pyTrace + pyTrace,
+			final:   true,
+			records: []string{"starting worker\n", pyTrace, pyTrace},
+			offsets: []int64{0, 16, 16 + int64(len(pyTrace))},
+		},
+		{
+			name:    "blank text is skipped",
+			preset:  PresetPython,
+			data:    "\n\n" + pyTrace,
+			final:   true,
+			records: []string{pyTrace},
+			offsets: []int64{2},
+		},
+		{
+			name:    "java thread dumps",
+			preset:  PresetJava,
+			data:    "2026-03-10 10:00:00\nFull thread dump OpenJDK:\n\"main\" #1\n2026-03-10 10:05:00\nFull thread dump OpenJDK:\n\"main\" #1\n",
+			final:   true,
+			records: []string{"2026-03-10 10:00:00\nFull thread dump OpenJDK:\n\"main\" #1\n", "2026-03-10 10:05:00\nFull thread dump OpenJDK:\n\"main\" #1\n"},
+			offsets: []int64{0, 56},
+		},
+		{
+			name:    "custom end pattern closes record",
+			preset:  PresetCustom,
+			start:   `^BEGIN`,
+			end:     `^END`,
+			data:    "BEGIN\na\nEND\nnoise\nBEGIN\nb\nEND\n",
+			records: []string{"BEGIN\na\nEND\n", "noise\n", "BEGIN\nb\nEND\n"},
+			offsets: []int64{0, 12, 18},
+		},
+		{
+			name:   "no records",
+			preset: PresetGo,
+			data:   "",
+			final:  true,
+		},
+	}
+	for _, test := range tests {
+		s, err := NewPreset(test.preset, test.start, test.end)
+		if err != nil {
+			t.Errorf("%s: NewPreset returned error %v", test.name, err)
+			continue
+		}
+		var records []string
+		var offsets []int64
+		for i, record := range s.Split([]byte(test.data), test.offset, test.final) {
+			if record.Index != i {
+				t.Errorf("%s: record %d has index %d", test.name, i, record.Index)
+			}
+			if record.Length != int64(len(record.Content)) {
+				t.Errorf("%s: record %d has length %d, content length %d", test.name, i, record.Length, len(record.Content))
+			}
+			records = append(records, string(record.Content))
+			offsets = append(offsets, record.Offset)
+		}
+		if !reflect.DeepEqual(records, test.records) {
+			t.Errorf("%s: records %q, expected %q", test.name, records, test.records)
+		}
+		if !reflect.DeepEqual(offsets, test.offsets) {
+			t.Errorf("%s: offsets %v, expected %v", test.name, offsets, test.offsets)
+		}
+	}
+}
+
+func TestNewPreset(t *testing.T) {
+	tests := []struct {
+		preset string
+		start  string
+		valid  bool
+	}{
+		{"java", "", true},
+		{"Go", "", true},
+		{"python", "", true},
+		{"custom", `^BEGIN`, true},
+		{"custom", `(`, false},
+		{"ruby", "", false},
+	}
+	for _, test := range tests {
+		_, err := NewPreset(test.preset, test.start, "")
+		if (err == nil) != test.valid {
+			t.Errorf("NewPreset(%q, %q) returned error %v", test.preset, test.start, err)
+		}
+	}
+}
@@ -16,3 +16,11 @@ func AsString() string {
 	bt := strings.Replace(buildTime, "_", " ", -1)
 	return fmt.Sprintf("%s (Build Time: %s, Commit: %s)", version, bt, commit)
 }
+
+// Version return release version of build
+func Version() string {
+	if version == "" {
+		return "dev"
+	}
+	return version
+}
@@ -0,0 +1,135 @@
+package viewer
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/consul"
+	"dumpbeat/pkg/exporter"
+	"dumpbeat/pkg/limiter"
+	"dumpbeat/pkg/log"
+	"fmt"
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoInstances is returned when consul has no healthy dump viewer instances
+var ErrNoInstances = errors.New("no healthy instances of dump viewer")
+
+var (
+	mux       sync.Mutex
+	once      sync.Once
+	instances []string
+	next      int
+)
+
+// Next return base url of dump viewer API for next request. Without consul service it is api_url. With consul
+// service healthy instances are chosen round robin skipping instances with open circuit breaker
+func Next() (string, error) {
+	config := root.GetConfig()
+	if config.APIConsulService == "" {
+		return strings.TrimRight(config.APIUrl, "/"), nil
+	}
+	once.Do(start)
+	mux.Lock()
+	defer mux.Unlock()
+	if len(instances) == 0 {
+		return "", errors.Wrapf(ErrNoInstances, "consul service %s", config.APIConsulService)
+	}
+	for i := 0; i < len(instances); i++ {
+		instance := instances[(next+i)%len(instances)]
+		if limiter.ForURL(instance).Breaker.State() != limiter.StateOpen {
+			next = (next + i + 1) % len(instances)
+			return instance, nil
+		}
+	}
+	// All breakers are open, breaker of chosen instance rejects request
+	instance := instances[next%len(instances)]
+	next = (next + 1) % len(instances)
+	return instance, nil
+}
+
+// start resolve instances before first request and watch for changes of consul catalog
+func start() {
+	config := root.GetConfig()
+	client, err := consul.NewConsulClient(config.ConsulHost)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Error create consul client for dump viewer discovery", err.Error()))
+		return
+	}
+	index, err := resolve(client, 0)
+	if err != nil {
+		log.Error(fmt.Sprintf("%s. Error resolve dump viewer service %s", err.Error(), config.APIConsulService))
+	}
+	go watch(client, index)
+}
+
+// watch refresh instances with blocking queries, which return as soon as healthy instances change
+func watch(client consul.Client, index uint64) {
+	config := root.GetConfig()
+	for {
+		newIndex, err := resolve(client, index)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error resolve dump viewer service %s, retry in 5s", err.Error(), config.APIConsulService))
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		if newIndex < index {
+			// Consul index went backwards (e.g. after restore of consul state), start over
+			newIndex = 0
+		}
+		index = newIndex
+	}
+}
+
+// resolve query healthy instances of dump viewer service. Zero wait index returns immediately
+func resolve(client consul.Client, waitIndex uint64) (uint64, error) {
+	config := root.GetConfig()
+	entries, meta, err := client.Service(config.APIConsulService, config.APIConsulTag,
+		&api.QueryOptions{WaitIndex: waitIndex, WaitTime: 5 * time.Minute})
+	if err != nil {
+		return waitIndex, err
+	}
+	urls := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		urls = append(urls, instanceURL(config.APIUrl, entry))
+	}
+	sort.Strings(urls)
+	setInstances(urls)
+	return meta.LastIndex, nil
+}
+
+func setInstances(urls []string) {
+	mux.Lock()
+	defer mux.Unlock()
+	exporter.ViewerInstancesGauge.Set(float64(len(urls)))
+	if strings.Join(urls, ",") == strings.Join(instances, ",") {
+		return
+	}
+	if len(urls) == 0 {
+		log.Error(fmt.Sprintf("No healthy instances of dump viewer service %s", root.GetConfig().APIConsulService))
+	} else {
+		log.Info(fmt.Sprintf("Dump viewer instances: %s", strings.Join(urls, ", ")))
+	}
+	instances = urls
+}
+
+// instanceURL return api_url with host replaced by address and port of service instance
+func instanceURL(apiURL string, entry *api.ServiceEntry) string {
+	address := entry.Service.Address
+	if address == "" {
+		address = entry.Node.Address
+	}
+	host := net.JoinHostPort(address, strconv.Itoa(entry.Service.Port))
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Scheme == "" {
+		return "http://" + host
+	}
+	u.Host = host
+	return strings.TrimRight(u.String(), "/")
+}
@@ -0,0 +1,145 @@
+package watcher
+
+import (
+	"dumpbeat/pkg/log"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"sync"
+)
+
+// closeWriteNotifier reports files closed after write. ErrOverflow is reported when events were lost
+type closeWriteNotifier interface {
+	Add(string) error
+	Remove(string) error
+	Events() <-chan string
+	Errors() <-chan error
+	Close() error
+}
+
+// fsnotifyBackend delivers inotify (kqueue, ReadDirectoryChangesW) events. Adding already watched
+// directory does nothing, so root directory probed in auto mode is not registered twice
+type fsnotifyBackend struct {
+	watcher    *fsnotify.Watcher
+	closeWrite closeWriteNotifier
+	dirs       map[string]bool
+	events     chan Event
+	errors     chan error
+	mux        sync.Mutex
+}
+
+func newFsnotifyBackend(closeWrite bool) (*fsnotifyBackend, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	b := &fsnotifyBackend{
+		watcher: w,
+		dirs:    make(map[string]bool),
+		events:  make(chan Event),
+		errors:  make(chan error),
+	}
+	if closeWrite {
+		b.closeWrite, err = newCloseWriteNotifier()
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Files with close_write readiness will be sent by walker after file wait time", err.Error()))
+		}
+	}
+	go b.run()
+	return b, nil
+}
+
+func (b *fsnotifyBackend) Add(dir string) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.dirs[dir] {
+		return nil
+	}
+	err := b.watcher.Add(dir)
+	if err != nil {
+		return err
+	}
+	b.dirs[dir] = true
+	if b.closeWrite != nil {
+		err = b.closeWrite.Add(dir)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error watch close write events in %s", err.Error(), dir))
+		}
+	}
+	return nil
+}
+
+func (b *fsnotifyBackend) Remove(dir string) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	delete(b.dirs, dir)
+	if b.closeWrite != nil {
+		err := b.closeWrite.Remove(dir)
+		if err != nil {
+			log.Debug(err.Error())
+		}
+	}
+	return b.watcher.Remove(dir)
+}
+
+func (b *fsnotifyBackend) Events() <-chan Event {
+	return b.events
+}
+
+func (b *fsnotifyBackend) Errors() <-chan error {
+	return b.errors
+}
+
+func (b *fsnotifyBackend) Close() error {
+	if b.closeWrite != nil {
+		err := b.closeWrite.Close()
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error close close write notifier", err.Error()))
+		}
+	}
+	return b.watcher.Close()
+}
+
+func (b *fsnotifyBackend) run() {
+	var closeEvents <-chan string
+	var closeErrors <-chan error
+	if b.closeWrite != nil {
+		closeEvents = b.closeWrite.Events()
+		closeErrors = b.closeWrite.Errors()
+	}
+	for {
+		select {
+		case fileName := <-closeEvents:
+			b.events <- Event{Name: fileName, Op: CloseWrite}
+		case err := <-closeErrors:
+			b.errors <- err
+		case event, ok := <-b.watcher.Events:
+			if !ok {
+				return
+			}
+			var op Op
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				op |= Create
+			}
+			if event.Op&fsnotify.Write == fsnotify.Write {
+				op |= Write
+			}
+			if event.Op&fsnotify.Remove == fsnotify.Remove {
+				op |= Remove
+			}
+			if event.Op&fsnotify.Rename == fsnotify.Rename {
+				op |= Rename
+			}
+			if op != 0 {
+				b.events <- Event{Name: event.Name, Op: op}
+			}
+		case err, ok := <-b.watcher.Errors:
+			if !ok {
+				return
+			}
+			if err == fsnotify.ErrEventOverflow {
+				err = ErrOverflow
+			}
+			b.errors <- err
+		}
+	}
+}
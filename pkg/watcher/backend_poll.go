@@ -0,0 +1,158 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	inode   uint64
+	isDir   bool
+}
+
+// pollBackend detects changes by comparing directory snapshots. Used for filesystems
+// without inotify support like NFS, FUSE or overlay volumes
+type pollBackend struct {
+	interval  time.Duration
+	snapshots map[string]map[string]fileState
+	events    chan Event
+	errors    chan error
+	done      chan struct{}
+	mux       sync.Mutex
+}
+
+func newPollBackend(interval time.Duration) *pollBackend {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	b := &pollBackend{
+		interval:  interval,
+		snapshots: make(map[string]map[string]fileState),
+		events:    make(chan Event),
+		errors:    make(chan error),
+		done:      make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *pollBackend) Add(dir string) error {
+	snapshot, err := readSnapshot(dir)
+	if err != nil {
+		return err
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.snapshots[dir] = snapshot
+	return nil
+}
+
+func (b *pollBackend) Remove(dir string) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	delete(b.snapshots, dir)
+	return nil
+}
+
+func (b *pollBackend) Events() <-chan Event {
+	return b.events
+}
+
+func (b *pollBackend) Errors() <-chan error {
+	return b.errors
+}
+
+func (b *pollBackend) Close() error {
+	close(b.done)
+	return nil
+}
+
+func (b *pollBackend) run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.poll()
+		}
+	}
+}
+
+// poll compare current content of watched directories with previous snapshots
+func (b *pollBackend) poll() {
+	b.mux.Lock()
+	dirs := make([]string, 0, len(b.snapshots))
+	for dir := range b.snapshots {
+		dirs = append(dirs, dir)
+	}
+	b.mux.Unlock()
+	for _, dir := range dirs {
+		current, err := readSnapshot(dir)
+		if os.IsNotExist(err) {
+			b.mux.Lock()
+			delete(b.snapshots, dir)
+			b.mux.Unlock()
+			b.events <- Event{Name: dir, Op: Remove}
+			continue
+		}
+		if err != nil {
+			b.errors <- err
+			continue
+		}
+		b.mux.Lock()
+		previous, ok := b.snapshots[dir]
+		if ok {
+			b.snapshots[dir] = current
+		}
+		b.mux.Unlock()
+		if !ok {
+			continue
+		}
+		for _, event := range diffSnapshots(dir, previous, current) {
+			b.events <- event
+		}
+	}
+}
+
+func diffSnapshots(dir string, previous, current map[string]fileState) []Event {
+	var events []Event
+	for name, state := range previous {
+		if newState, ok := current[name]; !ok || newState.inode != state.inode || newState.isDir != state.isDir {
+			events = append(events, Event{Name: filepath.Join(dir, name), Op: Remove})
+		}
+	}
+	for name, state := range current {
+		oldState, ok := previous[name]
+		switch {
+		case !ok || oldState.inode != state.inode || oldState.isDir != state.isDir:
+			events = append(events, Event{Name: filepath.Join(dir, name), Op: Create})
+		case !state.isDir && (oldState.size != state.size || !oldState.modTime.Equal(state.modTime)):
+			events = append(events, Event{Name: filepath.Join(dir, name), Op: Write})
+		}
+	}
+	return events
+}
+
+func readSnapshot(dir string) (map[string]fileState, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(map[string]fileState, len(entries))
+	for _, entry := range entries {
+		snapshot[entry.Name()] = fileState{
+			size:    entry.Size(),
+			modTime: entry.ModTime(),
+			inode:   fileInode(entry),
+			isDir:   entry.IsDir(),
+		}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,132 @@
+//go:build linux
+// +build linux
+
+package watcher
+
+import (
+	"dumpbeat/pkg/log"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyCloseWrite reports files closed after write. fsnotify doesn't expose IN_CLOSE_WRITE,
+// so separate inotify instance is used for the same directories. Non-blocking descriptor is read
+// through runtime poller, so Close interrupts waiting reader
+type inotifyCloseWrite struct {
+	fd     int
+	file   *os.File
+	closed chan struct{}
+	done   chan struct{}
+	paths  map[int]string
+	wds    map[string]int
+	events chan string
+	errors chan error
+	mux    sync.Mutex
+}
+
+func newCloseWriteNotifier() (closeWriteNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	n := &inotifyCloseWrite{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+		paths:  make(map[int]string),
+		wds:    make(map[string]int),
+		events: make(chan string, 1024),
+		errors: make(chan error, 1),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotifyCloseWrite) Add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, syscall.IN_CLOSE_WRITE|syscall.IN_ONLYDIR)
+	if err != nil {
+		return err
+	}
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.paths[wd] = dir
+	n.wds[dir] = wd
+	return nil
+}
+
+func (n *inotifyCloseWrite) Remove(dir string) error {
+	n.mux.Lock()
+	wd, ok := n.wds[dir]
+	delete(n.wds, dir)
+	delete(n.paths, wd)
+	n.mux.Unlock()
+	if !ok {
+		return nil
+	}
+	_, err := syscall.InotifyRmWatch(n.fd, uint32(wd))
+	return err
+}
+
+func (n *inotifyCloseWrite) Events() <-chan string {
+	return n.events
+}
+
+func (n *inotifyCloseWrite) Errors() <-chan error {
+	return n.errors
+}
+
+// Close inotify descriptor and wait until reader stops
+func (n *inotifyCloseWrite) Close() error {
+	close(n.closed)
+	err := n.file.Close()
+	<-n.done
+	return err
+}
+
+func (n *inotifyCloseWrite) read() {
+	defer close(n.done)
+	buf := make([]byte, syscall.SizeofInotifyEvent*4096)
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			if pathErr, ok := err.(*os.PathError); !ok || pathErr.Err != os.ErrClosed {
+				log.Error(fmt.Sprintf("%s. Error read close write events", err.Error()))
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			offset = nameEnd
+			if event.Mask&syscall.IN_Q_OVERFLOW == syscall.IN_Q_OVERFLOW {
+				// Close write events were lost, watcher resyncs dump directory. Pending report is enough
+				select {
+				case n.errors <- ErrOverflow:
+				default:
+				}
+				continue
+			}
+			if event.Mask&syscall.IN_CLOSE_WRITE != syscall.IN_CLOSE_WRITE || event.Len == 0 {
+				continue
+			}
+			name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+			n.mux.Lock()
+			dir, ok := n.paths[int(event.Wd)]
+			n.mux.Unlock()
+			if ok {
+				select {
+				case n.events <- filepath.Join(dir, name):
+				case <-n.closed:
+					return
+				}
+			}
+		}
+	}
+}
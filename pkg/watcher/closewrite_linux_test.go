@@ -0,0 +1,77 @@
+//go:build linux
+// +build linux
+
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsnotifyBackendCloseWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backend, err := newFsnotifyBackend(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.closeWrite == nil {
+		t.Fatal("close write notifier is not created")
+	}
+	// Root directory is added by auto mode probe and then by watcher
+	for i := 0; i < 2; i++ {
+		if err = backend.Add(dir); err != nil {
+			t.Fatalf("Add returned error %v", err)
+		}
+	}
+	notifier := backend.closeWrite.(*inotifyCloseWrite)
+	if len(notifier.wds) != 1 {
+		t.Errorf("close write watches %v, expected one", notifier.wds)
+	}
+
+	fileName := filepath.Join(dir, "dump.txt")
+	if err = ioutil.WriteFile(fileName, []byte("dump"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	closed := 0
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case event := <-backend.Events():
+			if event.Name == fileName && event.Op&CloseWrite == CloseWrite {
+				closed++
+			}
+		case err := <-backend.Errors():
+			t.Errorf("backend reported error %v", err)
+		case <-timeout:
+			done = true
+		}
+	}
+	if closed != 1 {
+		t.Errorf("received %d close write events, expected 1", closed)
+	}
+
+	closeDone := make(chan error)
+	go func() {
+		closeDone <- backend.Close()
+	}()
+	select {
+	case err = <-closeDone:
+		if err != nil {
+			t.Errorf("Close returned error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close doesn't stop close write reader")
+	}
+	select {
+	case <-notifier.done:
+	default:
+		t.Error("close write reader is running after Close")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package watcher
+
+import "github.com/pkg/errors"
+
+func newCloseWriteNotifier() (closeWriteNotifier, error) {
+	return nil, errors.New("close write events are supported on linux only")
+}
@@ -0,0 +1,21 @@
+package watcher
+
+import "syscall"
+
+// Magic numbers of filesystems which don't deliver inotify events for all changes
+var pollingFilesystems = map[int64]string{
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x794c7630: "overlay",
+}
+
+// pollingFilesystem return name of filesystem of directory when inotify is unreliable on it
+func pollingFilesystem(dir string) string {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return ""
+	}
+	return pollingFilesystems[int64(stat.Type)]
+}
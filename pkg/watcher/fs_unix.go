@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package watcher
+
+import (
+	"os"
+	"syscall"
+)
+
+func fileInode(fileInfo os.FileInfo) uint64 {
+	if stat, ok := fileInfo.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,7 @@
+package watcher
+
+import "os"
+
+func fileInode(os.FileInfo) uint64 {
+	return 0
+}
@@ -4,65 +4,134 @@ import (
 	root "dumpbeat/pkg"
 	"dumpbeat/pkg/common"
 	"dumpbeat/pkg/dump"
+	"dumpbeat/pkg/exporter"
 	"dumpbeat/pkg/log"
+	"dumpbeat/pkg/readiness"
 	"fmt"
-	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
 	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
+const (
+	maxUserWatchesFile = "/proc/sys/fs/inotify/max_user_watches"
+	// BackendAuto use fsnotify and fall back to polling when inotify is unavailable
+	BackendAuto = "auto"
+	// BackendFsnotify use filesystem notifications
+	BackendFsnotify = "fsnotify"
+	// BackendPoll periodically compare directory snapshots
+	BackendPoll = "poll"
+)
+
+// Op describes set of filesystem changes
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	CloseWrite
+)
+
+var opNames = []struct {
+	op   Op
+	name string
+}{
+	{Create, "create"},
+	{Write, "write"},
+	{Remove, "remove"},
+	{Rename, "rename"},
+	{CloseWrite, "close_write"},
+}
+
+// names return names of changes in set
+func (op Op) names() []string {
+	var names []string
+	for _, opName := range opNames {
+		if op&opName.op == opName.op {
+			names = append(names, opName.name)
+		}
+	}
+	return names
+}
+
+// Event is filesystem change of file or directory
+type Event struct {
+	Name string
+	Op   Op
+}
+
+// ErrOverflow is reported when backend lost events
+var ErrOverflow = errors.New("filesystem events queue overflow")
+
+// Backend delivers events of watched directories (not recursive)
+type Backend interface {
+	Add(string) error
+	Remove(string) error
+	Events() <-chan Event
+	Errors() <-chan error
+	Close() error
+}
+
 type FSWatcher struct {
-	*fsnotify.Watcher
+	backend        Backend
+	pending        *common.FileScheduler
+	rootDir        string
+	dirs           map[string]bool
+	maxUserWatches int
+	// syncedAt is start of watching or of last resync. Files changed before are left to walker
+	syncedAt time.Time
+	mux      sync.Mutex
 }
 
-func (fsWatcher FSWatcher) watch(pf *common.ProcessedFiles) {
+func (fsWatcher *FSWatcher) watch() {
 	log.Info("Start filesystem watcher")
 	for {
 		select {
-		case event, ok := <-fsWatcher.Events:
-			if !ok {
-				continue
-			}
+		case event := <-fsWatcher.backend.Events():
 			log.Debug("event:", event)
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				fileInfo, err := os.Stat(event.Name)
-				if err != nil {
-					log.Error(err.Error())
-					continue
-				}
-				if !fileInfo.IsDir() {
-					log.Debug("modified file:", event.Name)
-					pf.Add(event.Name, time.Now())
-				}
+			for _, op := range event.Op.names() {
+				exporter.WatcherEventsCounter.WithLabelValues(op).Inc()
+			}
+			if event.Op&CloseWrite == CloseWrite {
+				fsWatcher.schedule(event.Name, readiness.MarkClosed(event.Name))
+				continue
 			}
-			if event.Op&fsnotify.Create == fsnotify.Create {
+			if event.Op&Write == Write || event.Op&Create == Create {
 				fileInfo, err := os.Stat(event.Name)
 				if err != nil {
-					log.Error(err.Error())
+					log.Debug(err.Error())
 					continue
 				}
 				if fileInfo.IsDir() {
-					err := fsWatcher.Add(event.Name)
-					if err != nil {
-						log.Fatal(err.Error())
-						continue
+					if event.Op&Create == Create {
+						// Directory may be created with content or moved from another place
+						fsWatcher.addTree(event.Name, true)
 					}
-					log.Info(fmt.Sprintf("Added new directory %s for watch", event.Name))
+					continue
 				}
+				log.Debug("modified file:", event.Name)
+				fsWatcher.schedule(event.Name, time.Now())
 			}
-			if event.Op&fsnotify.Remove == fsnotify.Remove {
-				err := fsWatcher.Remove(event.Name)
-				if err != nil {
-					log.Debug(err.Error())
+			if event.Op&Remove == Remove || event.Op&Rename == Rename {
+				if fsWatcher.isWatched(event.Name) {
+					fsWatcher.removeTree(event.Name)
 					continue
 				}
-				log.Info(fmt.Sprintf("Remove directory %s from watch", event.Name))
+				fsWatcher.pending.Delete(event.Name)
+				readiness.Forget(event.Name)
 			}
-		case err, ok := <-fsWatcher.Errors:
-			if !ok {
+		case err := <-fsWatcher.backend.Errors():
+			if err == ErrOverflow {
+				log.Error(fmt.Sprintf("Filesystem events queue overflow, resync %s", fsWatcher.rootDir))
+				fsWatcher.resync()
 				continue
 			}
 			log.Error("error:", err)
@@ -70,76 +139,246 @@ func (fsWatcher FSWatcher) watch(pf *common.ProcessedFiles) {
 	}
 }
 
+// addTree add directory with all subdirectories to watch. Files found in new directories are scheduled
+// for processing, because they could be created before directory was added to watch
+func (fsWatcher *FSWatcher) addTree(dir string, scheduleFiles bool) {
+	err := filepath.Walk(dir, func(fileName string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			log.Debug(err.Error())
+			return nil
+		}
+		if !fileInfo.IsDir() {
+			if scheduleFiles {
+				fsWatcher.schedule(fileName, time.Now())
+			}
+			return nil
+		}
+		if fsWatcher.isWatched(fileName) {
+			return nil
+		}
+		err = fsWatcher.addDir(fileName)
+		if err != nil {
+			log.Error(err.Error())
+			if err == syscall.ENOSPC {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err.Error())
+	}
+}
+
+func (fsWatcher *FSWatcher) addDir(dir string) error {
+	err := fsWatcher.backend.Add(dir)
+	if err == syscall.ENOSPC {
+		log.Error(fmt.Sprintf("Cannot watch %s: inotify watches limit %d reached (%s)", dir, fsWatcher.maxUserWatches, maxUserWatchesFile))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	fsWatcher.mux.Lock()
+	fsWatcher.dirs[dir] = true
+	count := len(fsWatcher.dirs)
+	fsWatcher.mux.Unlock()
+	exporter.WatchedDirectoriesGauge.Set(float64(count))
+	if fsWatcher.maxUserWatches > 0 && count*10 >= fsWatcher.maxUserWatches*9 {
+		log.Error(fmt.Sprintf("Watched directories %d close to inotify limit %d", count, fsWatcher.maxUserWatches))
+	}
+	log.Info(fmt.Sprintf("Added %s to watch", dir))
+	return nil
+}
+
+// removeTree remove directory with all subdirectories from watch
+func (fsWatcher *FSWatcher) removeTree(dir string) {
+	prefix := dir + string(os.PathSeparator)
+	fsWatcher.mux.Lock()
+	var removed []string
+	for watched := range fsWatcher.dirs {
+		if watched == dir || strings.HasPrefix(watched, prefix) {
+			removed = append(removed, watched)
+			delete(fsWatcher.dirs, watched)
+		}
+	}
+	count := len(fsWatcher.dirs)
+	fsWatcher.mux.Unlock()
+	exporter.WatchedDirectoriesGauge.Set(float64(count))
+	for _, watched := range removed {
+		// Watch of removed or moved away directory may be already dropped by kernel
+		err := fsWatcher.backend.Remove(watched)
+		if err != nil {
+			log.Debug(err.Error())
+		}
+		log.Info(fmt.Sprintf("Remove directory %s from watch", watched))
+	}
+}
+
+// resync drop watches of disappeared directories, add missed ones and schedule files changed since
+// watching started or previous resync, because their events could be lost. Older files are sent by walker,
+// as well as files not fitting into pending files limit
+func (fsWatcher *FSWatcher) resync() {
+	since := fsWatcher.syncedAt.Add(-time.Second)
+	fsWatcher.syncedAt = time.Now()
+	fsWatcher.mux.Lock()
+	var gone []string
+	for dir := range fsWatcher.dirs {
+		if fileInfo, err := os.Stat(dir); err != nil || !fileInfo.IsDir() {
+			gone = append(gone, dir)
+		}
+	}
+	fsWatcher.mux.Unlock()
+	for _, dir := range gone {
+		fsWatcher.removeTree(dir)
+	}
+	fsWatcher.addTree(fsWatcher.rootDir, false)
+	skipped := 0
+	err := filepath.Walk(fsWatcher.rootDir, func(fileName string, fileInfo os.FileInfo, err error) error {
+		if err != nil || fileInfo.IsDir() || fileInfo.ModTime().Before(since) {
+			return nil
+		}
+		if skipped > 0 || !fsWatcher.trySchedule(fileName, time.Now()) {
+			skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err.Error())
+	}
+	if skipped > 0 {
+		log.Error(fmt.Sprintf("Pending files limit %d reached on resync, %d files will be sent by walker", root.GetConfig().PendingFilesLimit, skipped))
+	}
+}
+
+// schedule check of file readiness after event
+func (fsWatcher *FSWatcher) schedule(fileName string, lastEvent time.Time) {
+	if !fsWatcher.trySchedule(fileName, lastEvent) {
+		log.Error(fmt.Sprintf("Pending files limit %d reached, %s will be sent by walker", root.GetConfig().PendingFilesLimit, fileName))
+	}
+}
+
+// trySchedule check of file readiness after event. Creation of marker file schedules its dump file.
+// Returns false when pending files limit is reached
+func (fsWatcher *FSWatcher) trySchedule(fileName string, lastEvent time.Time) bool {
+	config := root.GetConfig()
+	if config.ReadinessMarkerSuffix != "" && strings.HasSuffix(fileName, config.ReadinessMarkerSuffix) {
+		dumpFile := strings.TrimSuffix(fileName, config.ReadinessMarkerSuffix)
+		if readiness.Strategy(dumpFile) == readiness.StrategyMarker {
+			fileName = dumpFile
+		}
+	}
+	return fsWatcher.pending.Schedule(fileName, lastEvent, readiness.For(fileName).Deadline(fileName, lastEvent))
+}
+
+// process send pending files when they become ready
+func (fsWatcher *FSWatcher) process() {
+	for {
+		pending, ok := fsWatcher.pending.Next(nil)
+		if !ok {
+			return
+		}
+		fileInfo, err := os.Stat(pending.Name)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s: Error stat file %s.", err.Error(), pending.Name))
+			readiness.Forget(pending.Name)
+			continue
+		}
+		checker := readiness.For(pending.Name)
+		if !checker.Ready(pending.Name, fileInfo, pending.LastEvent) {
+			if !fsWatcher.pending.Schedule(pending.Name, pending.LastEvent, checker.Deadline(pending.Name, time.Now())) {
+				log.Error(fmt.Sprintf("Pending files limit %d reached, %s will be sent by walker", root.GetConfig().PendingFilesLimit, pending.Name))
+				readiness.Forget(pending.Name)
+			}
+			continue
+		}
+		err = dump.VisitFileWithoutWaitTime(pending.Name, fileInfo, nil)
+		if err != nil {
+			log.Error(fmt.Sprintf("%s. Error visit file %s", err.Error(), pending.Name))
+		}
+		readiness.Forget(pending.Name)
+	}
+}
+
+func (fsWatcher *FSWatcher) isWatched(dir string) bool {
+	fsWatcher.mux.Lock()
+	defer fsWatcher.mux.Unlock()
+	return fsWatcher.dirs[dir]
+}
+
+// readMaxUserWatches return inotify watches limit of current user or 0 if unknown
+func readMaxUserWatches() int {
+	content, err := ioutil.ReadFile(maxUserWatchesFile)
+	if err != nil {
+		return 0
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0
+	}
+	return limit
+}
+
+// newBackend create configured watcher backend. In auto mode polling is used for network, FUSE and overlay
+// filesystems and when inotify can't watch root directory
+func newBackend(config *root.Config, rootDir string) (Backend, error) {
+	interval := time.Duration(config.WatcherPollInterval) * time.Second
+	switch config.WatcherBackend {
+	case BackendPoll:
+		return newPollBackend(interval), nil
+	case BackendFsnotify:
+		return newFsnotifyBackend(readiness.Uses(readiness.StrategyCloseWrite))
+	}
+	if fsType := pollingFilesystem(rootDir); fsType != "" {
+		log.Info(fmt.Sprintf("Directory %s is on %s filesystem, using polling watcher", rootDir, fsType))
+		return newPollBackend(interval), nil
+	}
+	backend, err := newFsnotifyBackend(readiness.Uses(readiness.StrategyCloseWrite))
+	if err == nil {
+		err = backend.Add(rootDir)
+		if err == nil {
+			return backend, nil
+		}
+		_ = backend.Close()
+	}
+	log.Error(fmt.Sprintf("%s. Filesystem notifications unavailable, using polling watcher", err.Error()))
+	return newPollBackend(interval), nil
+}
+
 func FSWatch() {
 	config := root.GetConfig()
-	w, err := fsnotify.NewWatcher()
+	rootDir := filepath.Clean(config.DumpDir)
+	backend, err := newBackend(config, rootDir)
 	if err != nil {
-		log.Fatal(err)
+		log.Error(fmt.Sprintf("%s. Filesystem watcher disabled", err.Error()))
+		return
+	}
+	fsWatcher := &FSWatcher{
+		backend:  backend,
+		pending:  common.NewFileScheduler(config.PendingFilesLimit),
+		rootDir:  rootDir,
+		dirs:     make(map[string]bool),
+		syncedAt: time.Now(),
+	}
+	if _, ok := backend.(*fsnotifyBackend); ok {
+		fsWatcher.maxUserWatches = readMaxUserWatches()
+		exporter.MaxUserWatchesGauge.Set(float64(fsWatcher.maxUserWatches))
 	}
-	var fsWatcher FSWatcher
-	fsWatcher.Watcher = w
 	defer func() {
-		err := fsWatcher.Close()
+		err := fsWatcher.backend.Close()
 		if err != nil {
 			log.Error(err.Error())
 		}
 	}()
 	done := make(chan bool)
-	pf := common.ProcessedFiles{}
-	pf.Files = make(map[string]time.Time)
-	go func() {
-		for {
-			if len(pf.Files) > 0 {
-				for file, modifiedTime := range pf.Files {
-					if time.Since(modifiedTime) > 10*time.Second {
-						fileInfo, err := os.Stat(file)
-						if err != nil {
-							log.Error(fmt.Sprintf("%s: Error stat file %s.", err.Error(), file))
-							continue
-						}
-						err = dump.VisitFileWithoutWaitTime(file, fileInfo, nil)
-						if err != nil {
-							log.Error(fmt.Sprintf("%s. Error visit file %s", err.Error(), file))
-							continue
-						}
-						pf.Delete(file)
-					}
-				}
-			}
-			<-time.After(5 * time.Second)
-		}
-	}()
-	go fsWatcher.watch(&pf)
-	err = fsWatcher.Add(config.DumpDir)
+	go fsWatcher.process()
+	go fsWatcher.watch()
+	err = fsWatcher.addDir(rootDir)
 	if err != nil {
-		log.Fatal(err.Error())
-	}
-	log.Info(fmt.Sprintf("Added %s to watch", config.DumpDir))
-	objects, err := ioutil.ReadDir(config.DumpDir)
-	if err != nil {
-		log.Fatal(err.Error())
+		log.Error(fmt.Sprintf("%s. Filesystem watcher disabled, dumps will be sent by walker", err.Error()))
+		return
 	}
 	log.Info(fmt.Sprintf("Add directories from root dir `%s` to watch", config.DumpDir))
-	for _, object := range objects {
-		if object.IsDir() {
-			err := filepath.Walk(path.Join(config.DumpDir, object.Name()), func(fileName string, fileInfo os.FileInfo, err error) error {
-				if err != nil {
-					log.Error(err.Error())
-					return nil
-				}
-				if fileInfo.IsDir() {
-					err := fsWatcher.Add(fileName)
-					if err != nil {
-						log.Fatal(err.Error())
-					}
-					log.Info(fmt.Sprintf("Added %s to watch", fileName))
-				}
-				return nil
-			})
-			if err != nil {
-				log.Error(err.Error())
-			}
-		}
-	}
+	fsWatcher.addTree(rootDir, false)
 	<-done
 }
@@ -0,0 +1,114 @@
+package watcher
+
+import (
+	root "dumpbeat/pkg"
+	"dumpbeat/pkg/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, fileName string, modTime time.Time) {
+	err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(fileName, []byte(fileName), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(fileName, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pendingNames drain scheduler. Readiness deadlines are due immediately with zero quiet period
+func pendingNames(pending *common.FileScheduler) []string {
+	var names []string
+	for pending.Len() > 0 {
+		file, _ := pending.Next(nil)
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestResync(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+	config := *root.GetConfig()
+	config.DumpDir = rootDir
+	config.ReadinessStrategy = "quiet"
+	config.ReadinessQuietPeriod = 0
+	config.PendingFilesLimit = 2
+	root.SetConfig(&config)
+	syncedAt := time.Now().Add(-time.Hour)
+	old := filepath.Join(rootDir, "app", "old.txt")
+	writeTestFile(t, old, syncedAt.Add(-time.Hour))
+	var changed []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		changed = append(changed, filepath.Join(rootDir, "app", "new", name))
+		writeTestFile(t, changed[len(changed)-1], time.Now())
+	}
+	gone := filepath.Join(rootDir, "gone")
+
+	tests := []struct {
+		name    string
+		limit   int
+		pending []string
+	}{
+		{"files changed since sync", 0, changed},
+		{"pending files limit", 2, changed[:2]},
+	}
+	for _, test := range tests {
+		backend := newPollBackend(time.Hour)
+		fsWatcher := &FSWatcher{
+			backend:  backend,
+			pending:  common.NewFileScheduler(test.limit),
+			rootDir:  rootDir,
+			dirs:     map[string]bool{rootDir: true, gone: true},
+			syncedAt: syncedAt,
+		}
+		fsWatcher.resync()
+		if names := pendingNames(fsWatcher.pending); !equalNames(names, test.pending) {
+			t.Errorf("%s: resync scheduled %v, expected %v", test.name, names, test.pending)
+		}
+		for _, dir := range []string{filepath.Join(rootDir, "app"), filepath.Join(rootDir, "app", "new")} {
+			if !fsWatcher.isWatched(dir) {
+				t.Errorf("%s: missed directory %s is not watched after resync", test.name, dir)
+			}
+		}
+		if fsWatcher.isWatched(gone) {
+			t.Errorf("%s: removed directory %s is watched after resync", test.name, gone)
+		}
+		if !fsWatcher.syncedAt.After(syncedAt) {
+			t.Errorf("%s: sync time %s is not moved by resync", test.name, fsWatcher.syncedAt)
+		}
+		// Files changed before last sync are left to walker
+		fsWatcher.syncedAt = time.Now().Add(time.Hour)
+		fsWatcher.resync()
+		if names := pendingNames(fsWatcher.pending); len(names) != 0 {
+			t.Errorf("%s: second resync scheduled %v, expected nothing", test.name, names)
+		}
+		_ = backend.Close()
+	}
+}
+
+func equalNames(names, expected []string) bool {
+	if len(names) != len(expected) {
+		return false
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}